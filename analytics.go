@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Rates are computed over the last rateWindow, from samples taken
+// every rateSampleEvery, once the crawl ran for minRateWindow
+const (
+	rateWindow      = 5 * time.Minute
+	rateSampleEvery = 10 * time.Second
+	minRateWindow   = 30 * time.Second
+)
+
+// What became of the links found: queued, already visited or queued,
+// or out of scope
+type frontierStats struct {
+	discovered int
+	duplicates int
+	outOfScope int
+	samples    []frontierSample
+}
+
+type frontierSample struct {
+	at         time.Time
+	discovered int
+	crawled    int
+}
+
+// Growth of the frontier, shown by the dashboard, /debug/crawler
+// and the final report. Rates are URLs per minute.
+type frontierReport struct {
+	Discovered     int     `json:"discovered"`
+	Duplicates     int     `json:"duplicates"`
+	OutOfScope     int     `json:"out_of_scope"`
+	DiscoveryRate  float64 `json:"discovery_rate"`
+	CompletionRate float64 `json:"completion_rate"`
+	DuplicateRatio float64 `json:"duplicate_ratio"`
+	ScopeRatio     float64 `json:"out_of_scope_ratio"`
+	// The crawl ran long enough for the rates and the ETA
+	Measured bool `json:"measured"`
+	// Time to empty the queue at the current rates; when the queue
+	// is not shrinking Growing is set instead
+	ETA     time.Duration `json:"eta"`
+	Growing bool          `json:"growing"`
+}
+
+// Count a link found: "queued", "duplicate" or "out-of-scope"
+func (p *progress) link(outcome string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// Before counting it, for the first sample of the crawl
+	p.sample(time.Now())
+	switch outcome {
+	case "queued":
+		p.frontier.discovered++
+	case "duplicate":
+		p.frontier.duplicates++
+	case "out-of-scope":
+		p.frontier.outOfScope++
+	}
+}
+
+// Take a sample for the rates if due, dropping the ones out of the
+// window but the last of them; p.mu is held
+func (p *progress) sample(now time.Time) {
+	f := &p.frontier
+	if n := len(f.samples); n > 0 && now.Sub(f.samples[n-1].at) < rateSampleEvery {
+		return
+	}
+	f.samples = append(f.samples, frontierSample{at: now, discovered: f.discovered, crawled: p.crawled})
+	for len(f.samples) > 2 && now.Sub(f.samples[1].at) > rateWindow {
+		f.samples = f.samples[1:]
+	}
+}
+
+func (p *progress) frontierReport() frontierReport {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	f := p.frontier
+	report := frontierReport{Discovered: f.discovered, Duplicates: f.duplicates, OutOfScope: f.outOfScope}
+	if found := f.discovered + f.duplicates + f.outOfScope; found > 0 {
+		report.DuplicateRatio = float64(f.duplicates) / float64(found)
+		report.ScopeRatio = float64(f.outOfScope) / float64(found)
+	}
+	if len(f.samples) == 0 {
+		return report
+	}
+	first := f.samples[0]
+	elapsed := time.Since(first.at)
+	if elapsed < minRateWindow {
+		return report
+	}
+	minutes := elapsed.Minutes()
+	report.Measured = true
+	report.DiscoveryRate = float64(f.discovered-first.discovered) / minutes
+	report.CompletionRate = float64(p.crawled-first.crawled) / minutes
+	drain := report.CompletionRate - report.DiscoveryRate
+	switch {
+	case p.queued == 0:
+	case drain <= 0:
+		report.Growing = true
+	default:
+		report.ETA = time.Duration(float64(p.queued) / drain * float64(time.Minute))
+	}
+	return report
+}
+
+func (r frontierReport) etaString() string {
+	if !r.Measured {
+		return "not known yet"
+	}
+	if r.Growing {
+		return "never at the current rates, the frontier is growing"
+	}
+	return r.ETA.Round(time.Second).String()
+}
+
+// Print the frontier analytics
+func (c *Crawler) printFrontier() {
+	r := c.progress.frontierReport()
+	fmt.Println("Frontier:")
+	fmt.Printf("  discovered: %d\n", r.Discovered)
+	if r.Measured {
+		fmt.Printf("  discovery: %.1f per minute\n", r.DiscoveryRate)
+		fmt.Printf("  completion: %.1f per minute\n", r.CompletionRate)
+	}
+	fmt.Printf("  duplicates: %d (%.1f%%)\n", r.Duplicates, r.DuplicateRatio*100)
+	fmt.Printf("  out of scope: %d (%.1f%%)\n", r.OutOfScope, r.ScopeRatio*100)
+	if r.Growing || r.ETA > 0 {
+		fmt.Printf("  ETA: %s\n", r.etaString())
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Attributes holding asset URLs, lazy-loading ones included
+var assetAttrs = map[string][]string{
+	"img":    {"src", "data-src", "data-lazy-src", "data-original"},
+	"source": {"src", "data-src"},
+	"script": {"src"},
+	"video":  {"poster"},
+	"audio":  {"src"},
+	"embed":  {"src"},
+}
+
+// Attributes holding srcset candidate lists
+var srcsetAttrs = map[string][]string{
+	"img":    {"srcset", "data-srcset"},
+	"source": {"srcset", "data-srcset"},
+}
+
+// Rel values of <link> elements pointing to assets
+var assetRels = map[string]bool{
+	"stylesheet":       true,
+	"icon":             true,
+	"shortcut":         true,
+	"apple-touch-icon": true,
+	"preload":          true,
+}
+
+// Find the images, scripts, stylesheets and media of the page.
+// srcsetMode is "all" to take every srcset candidate or
+// "largest" to take only the biggest one.
+func extractAssets(doc *html.Node, srcsetMode string) []string {
+	var assets []string
+	var findAssets func(*html.Node)
+	findAssets = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			for _, key := range assetAttrs[n.Data] {
+				if v := getAttr(n, key); v != "" {
+					assets = append(assets, v)
+				}
+			}
+			for _, key := range srcsetAttrs[n.Data] {
+				if v := getAttr(n, key); v != "" {
+					assets = append(assets, parseSrcset(v, srcsetMode)...)
+				}
+			}
+			if n.Data == "link" {
+				for _, rel := range strings.Fields(strings.ToLower(getAttr(n, "rel"))) {
+					if assetRels[rel] {
+						if v := getAttr(n, "href"); v != "" {
+							assets = append(assets, v)
+						}
+						break
+					}
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			findAssets(c)
+		}
+	}
+	findAssets(doc)
+	return assets
+}
+
+func getAttr(n *html.Node, key string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return strings.TrimSpace(attr.Val)
+		}
+	}
+	return ""
+}
+
+// A srcset is a comma separated list of "url [width]w" or "url [density]x"
+func parseSrcset(srcset string, mode string) []string {
+	var urls []string
+	largest := ""
+	largestSize := -1.0
+	for _, candidate := range strings.Split(srcset, ",") {
+		fields := strings.Fields(candidate)
+		if len(fields) == 0 {
+			continue
+		}
+		size := 1.0
+		if len(fields) > 1 {
+			descriptor := fields[1]
+			if v, err := strconv.ParseFloat(descriptor[:len(descriptor)-1], 64); err == nil {
+				size = v
+			}
+		}
+		urls = append(urls, fields[0])
+		if size > largestSize {
+			largest, largestSize = fields[0], size
+		}
+	}
+	if mode == "all" || largest == "" {
+		return urls
+	}
+	return []string{largest}
+}
+
+// Queue the assets of the page, resolved against its URL
+func (c *Crawler) queueAssets(doc *html.Node, base *url.URL, depth int) {
+	for _, link := range extractAssets(doc, c.Srcset) {
+		link, ok := c.filterLink(link)
+		if !ok {
+			continue
+		}
+		ref, err := url.Parse(link)
+		if err != nil {
+			continue
+		}
+		u := base.ResolveReference(ref)
+		if u.Scheme != "http" && u.Scheme != "https" {
+			continue
+		}
+		c.normalize(u)
+		c.enqueue(queueItem{URL: u.String(), Referrer: base.String(), Asset: true, Depth: depth})
+	}
+}
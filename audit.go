@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/csv"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// In headers-only mode nothing is saved: the headers of every
+// response are written to this CSV in the destination directory
+const headersFileName = "headers.csv"
+
+var headersColumns = []string{"url", "status", "content_type", "content_length", "cache_control", "server"}
+
+func (c *Crawler) writeHeaders(resp *http.Response) error {
+	if c.headersFile == nil {
+		os.MkdirAll(c.DestDir, os.ModePerm)
+		file, err := os.OpenFile(filepath.Join(c.DestDir, headersFileName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		c.headersFile = file
+	}
+	w := csv.NewWriter(c.headersFile)
+	if info, err := c.headersFile.Stat(); err == nil && info.Size() == 0 {
+		w.Write(headersColumns)
+	}
+	w.Write([]string{
+		resp.Request.URL.String(),
+		strconv.Itoa(resp.StatusCode),
+		resp.Header.Get("Content-Type"),
+		resp.Header.Get("Content-Length"),
+		resp.Header.Get("Cache-Control"),
+		resp.Header.Get("Server"),
+	})
+	w.Flush()
+	return w.Error()
+}
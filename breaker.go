@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Longest pause of a failing host, as a multiple of the cooldown
+const maxBreakerBackoff = 32
+
+// Recent outcomes of the requests to a host
+type hostHealth struct {
+	failures []bool
+	// Paused; the next outcome decides whether it stays so
+	open  bool
+	trips int
+}
+
+// Circuit breaker: a host failing at least rate of its last window
+// requests is not requested for the cooldown, doubled each time it
+// fails again right after
+type circuitBreaker struct {
+	window int
+	rate   float64
+	hosts  map[string]*hostHealth
+}
+
+func newCircuitBreaker(window int, rate float64) *circuitBreaker {
+	return &circuitBreaker{window: window, rate: rate, hosts: make(map[string]*hostHealth)}
+}
+
+// Failed requests: network errors, 429 and server errors
+func requestFailed(status int) bool {
+	return status == 0 || status == http.StatusTooManyRequests || status >= 500
+}
+
+// Record an outcome, returning by how many cooldowns the host must be
+// paused (0 if not) and whether a paused host is back
+func (b *circuitBreaker) record(host string, failed bool) (int, bool) {
+	h, ok := b.hosts[host]
+	if !ok {
+		h = &hostHealth{}
+		b.hosts[host] = h
+	}
+	if h.open {
+		if failed {
+			h.trips++
+			return min(1<<h.trips, maxBreakerBackoff), false
+		}
+		h.open, h.trips = false, 0
+		return 0, true
+	}
+	h.failures = append(h.failures, failed)
+	if len(h.failures) > b.window {
+		h.failures = h.failures[1:]
+	}
+	if len(h.failures) < b.window {
+		return 0, false
+	}
+	n := 0
+	for _, f := range h.failures {
+		if f {
+			n++
+		}
+	}
+	if float64(n) < b.rate*float64(b.window) {
+		return 0, false
+	}
+	h.open, h.failures = true, nil
+	return 1, false
+}
+
+// Pause the host while it is failing
+func (c *Crawler) checkHealth(host string, status int) {
+	if c.breaker == nil {
+		return
+	}
+	cooldowns, back := c.breaker.record(host, requestFailed(status))
+	if back {
+		fmt.Printf("Host %s is answering again, resuming it\n", host)
+	}
+	if cooldowns > 0 {
+		pause := c.BreakerCooldown * time.Duration(cooldowns)
+		fmt.Printf("Host %s is failing, pausing it for %s\n", host, pause)
+		c.throttle.pause(host, pause)
+	}
+}
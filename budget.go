@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Parse domain=pages pairs, e.g. example.com=1000,blog.example.com=200
+func parseBudgets(value string) (map[string]int, error) {
+	budgets := make(map[string]int)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		domain, pages, ok := strings.Cut(pair, "=")
+		n, err := strconv.Atoi(pages)
+		if !ok || domain == "" || err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid -budget %s, expected domain=pages", pair)
+		}
+		budgets[strings.ToLower(asciiHost(domain))] = n
+	}
+	return budgets, nil
+}
+
+// The budget of a host is the one of the most specific domain containing it
+func (c *Crawler) budgetDomain(host string) (string, bool) {
+	host = strings.ToLower(host)
+	for {
+		if _, ok := c.Budgets[host]; ok {
+			return host, true
+		}
+		i := strings.Index(host, ".")
+		if i < 0 {
+			return "", false
+		}
+		host = host[i+1:]
+	}
+}
+
+func (c *Crawler) budgetExhausted(host string) bool {
+	domain, ok := c.budgetDomain(host)
+	return ok && c.spent[domain] >= c.Budgets[domain]
+}
+
+// Count an HTML page of the host; when the budget runs out the queued
+// pages of the domain are dropped, the assets kept
+func (c *Crawler) spendBudget(host string) {
+	domain, ok := c.budgetDomain(host)
+	if !ok {
+		return
+	}
+	if c.spent == nil {
+		c.spent = make(map[string]int)
+	}
+	c.spent[domain]++
+	if c.spent[domain] == c.Budgets[domain] {
+		dropped := c.queue.Drop(func(item queueItem) bool {
+			if item.Asset {
+				return false
+			}
+			d, ok := c.budgetDomain(hostname(item.URL))
+			return ok && d == domain
+		})
+		fmt.Printf("Budget of %d pages for %s exhausted, %d queued pages dropped\n", c.Budgets[domain], domain, dropped)
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTP cache on disk, keyed by URL, honoring Cache-Control and Expires
+type diskCache struct {
+	dir       string
+	transport http.RoundTripper
+}
+
+func newDiskCache(dir string, transport http.RoundTripper) *diskCache {
+	return &diskCache{dir: dir, transport: transport}
+}
+
+func (dc *diskCache) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return dc.transport.RoundTrip(req)
+	}
+	file := dc.path(req.URL.String())
+
+	cached, storedAt, err := dc.load(file, req)
+	if err != nil {
+		resp, err := dc.transport.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		return dc.store(file, resp)
+	}
+	if isFresh(cached.Header, storedAt, time.Now()) {
+		return cached, nil
+	}
+
+	// Stale: revalidate with a conditional request
+	cond := req.Clone(req.Context())
+	if etag := cached.Header.Get("ETag"); etag != "" {
+		cond.Header.Set("If-None-Match", etag)
+	}
+	if lastModified := cached.Header.Get("Last-Modified"); lastModified != "" {
+		cond.Header.Set("If-Modified-Since", lastModified)
+	}
+	resp, err := dc.transport.RoundTrip(cond)
+	if err != nil {
+		cached.Body.Close()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusNotModified {
+		cached.Body.Close()
+		return dc.store(file, resp)
+	}
+	resp.Body.Close()
+	for _, h := range []string{"Cache-Control", "Expires", "Date", "ETag", "Last-Modified"} {
+		if v := resp.Header.Get(h); v != "" {
+			cached.Header.Set(h, v)
+		}
+	}
+	return dc.store(file, cached)
+}
+
+func (dc *diskCache) path(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(dc.dir, name[:2], name)
+}
+
+// The cache file holds the storage time followed by the dumped response,
+// whose body is read from the file
+func (dc *diskCache) load(file string, req *http.Request) (*http.Response, time.Time, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	reader := bufio.NewReader(f)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		f.Close()
+		return nil, time.Time{}, err
+	}
+	unix, err := strconv.ParseInt(strings.TrimSpace(line), 10, 64)
+	if err != nil {
+		f.Close()
+		return nil, time.Time{}, fmt.Errorf("invalid cache entry %s: %v", file, err)
+	}
+	resp, err := readFileResponse(reader, f, req)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return resp, time.Unix(unix, 0), nil
+}
+
+// Body of a response read from a file, closing the file with it
+type fileBody struct {
+	io.ReadCloser
+	file *os.File
+}
+
+func (b fileBody) Close() error {
+	b.ReadCloser.Close()
+	return b.file.Close()
+}
+
+// Read the response dumped in file from reader, its body left in the file
+func readFileResponse(reader *bufio.Reader, file *os.File, req *http.Request) (*http.Response, error) {
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	resp.Body = fileBody{ReadCloser: resp.Body, file: file}
+	return resp, nil
+}
+
+func (dc *diskCache) store(file string, resp *http.Response) (*http.Response, error) {
+	if !isCacheable(resp) {
+		return resp, nil
+	}
+	prefix := fmt.Sprintf("%d\n", time.Now().Unix())
+	return teeResponse(resp, file, prefix, false, func(err error) error {
+		fmt.Println("Error writing cache entry:", err)
+		return nil
+	})
+}
+
+var errIncompleteBody = errors.New("body not read to the end")
+
+// Body writing the response to a file while it is read, the file
+// replacing the old one when the body is read to the end. A body
+// closed before is not stored, or is read to the end with drain.
+type teeBody struct {
+	body  io.ReadCloser
+	pipe  *io.PipeWriter
+	done  chan error
+	out   *os.File
+	file  string
+	drain bool
+	fail  func(error) error
+	ended bool
+}
+
+// Write prefix and the response to file as its body is read; fail
+// handles the write errors, returning the error to give the reader
+func teeResponse(resp *http.Response, file, prefix string, drain bool, fail func(error) error) (*http.Response, error) {
+	os.MkdirAll(filepath.Dir(file), os.ModePerm)
+	out, err := os.Create(file + ".tmp")
+	if err != nil {
+		if err := fail(err); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		return resp, nil
+	}
+	reader, writer := io.Pipe()
+	stored := *resp
+	stored.Body = reader
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.WriteString(out, prefix)
+		if err == nil {
+			err = stored.Write(out)
+		}
+		reader.CloseWithError(err)
+		done <- err
+	}()
+	resp.Body = &teeBody{body: resp.Body, pipe: writer, done: done, out: out, file: file, drain: drain, fail: fail}
+	return resp, nil
+}
+
+func (t *teeBody) Read(p []byte) (int, error) {
+	n, err := t.body.Read(p)
+	if n > 0 && !t.ended {
+		t.pipe.Write(p[:n])
+	}
+	if err == io.EOF {
+		if ferr := t.finish(true); ferr != nil {
+			return n, ferr
+		}
+	}
+	return n, err
+}
+
+func (t *teeBody) Close() error {
+	var err error
+	if t.drain && !t.ended {
+		_, err = io.Copy(io.Discard, t)
+	}
+	t.finish(false)
+	if cerr := t.body.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Stop writing the file, keeping it if the body was read to the end
+func (t *teeBody) finish(complete bool) error {
+	if t.ended {
+		return nil
+	}
+	t.ended = true
+	if complete {
+		t.pipe.Close()
+	} else {
+		t.pipe.CloseWithError(errIncompleteBody)
+	}
+	err := <-t.done
+	if cerr := t.out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && complete {
+		err = os.Rename(t.out.Name(), t.file)
+	}
+	if err != nil || !complete {
+		os.Remove(t.out.Name())
+	}
+	if err != nil && complete {
+		return t.fail(err)
+	}
+	return nil
+}
+
+func isCacheable(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Vary") == "*" {
+		return false
+	}
+	_, noStore := parseCacheControl(resp.Header.Get("Cache-Control"))["no-store"]
+	return !noStore
+}
+
+// A cached response is fresh while its age is below max-age,
+// or below the lifetime given by Expires
+func isFresh(h http.Header, storedAt time.Time, now time.Time) bool {
+	cc := parseCacheControl(h.Get("Cache-Control"))
+	if _, ok := cc["no-cache"]; ok {
+		return false
+	}
+	age := now.Sub(storedAt)
+	if v, err := strconv.Atoi(h.Get("Age")); err == nil {
+		age += time.Duration(v) * time.Second
+	}
+	if v, ok := cc["max-age"]; ok {
+		seconds, err := strconv.Atoi(v)
+		return err == nil && age < time.Duration(seconds)*time.Second
+	}
+	if expires := h.Get("Expires"); expires != "" {
+		expiresAt, err := http.ParseTime(expires)
+		if err != nil {
+			return false
+		}
+		date, err := http.ParseTime(h.Get("Date"))
+		if err != nil {
+			date = storedAt
+		}
+		return age < expiresAt.Sub(date)
+	}
+	return false
+}
+
+func parseCacheControl(value string) map[string]string {
+	directives := make(map[string]string)
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, val, _ := strings.Cut(part, "=")
+		directives[strings.ToLower(strings.TrimSpace(name))] = strings.Trim(strings.TrimSpace(val), `"`)
+	}
+	return directives
+}
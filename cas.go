@@ -0,0 +1,94 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const manifestFileName = "manifest.jsonl"
+
+// Entry of the manifest of the content-addressable store
+type ManifestEntry struct {
+	URL         string    `json:"url"`
+	SHA256      string    `json:"sha256,omitempty"`
+	Size        int       `json:"size,omitempty"`
+	ContentType string    `json:"content_type,omitempty"`
+	Status      int       `json:"status,omitempty"`
+	FetchedAt   time.Time `json:"fetched_at"`
+	// Files saved under a shortened path: the path and the one it
+	// would have had, relative to the destination directory
+	Path     string `json:"path,omitempty"`
+	LongPath string `json:"long_path,omitempty"`
+}
+
+// Path of an object: objects/ab/cdef...
+func objectPath(destDir string, sum string) string {
+	return filepath.Join(destDir, "objects", sum[:2], sum[2:])
+}
+
+// Save the body under its SHA-256, once for identical contents,
+// and record the URL in the manifest
+func (c *Crawler) saveObject(urlStr string, data []byte, resp *http.Response) (string, error) {
+	hash := sha256.Sum256(data)
+	sum := hex.EncodeToString(hash[:])
+	objPath := objectPath(c.DestDir, sum)
+
+	if _, err := os.Stat(objPath); os.IsNotExist(err) {
+		os.MkdirAll(filepath.Dir(objPath), os.ModePerm)
+		tmp := objPath + ".tmp"
+		if err := os.WriteFile(tmp, data, 0644); err != nil {
+			return "", err
+		}
+		if err := os.Rename(tmp, objPath); err != nil {
+			return "", err
+		}
+	}
+
+	entry := ManifestEntry{
+		URL:         urlStr,
+		SHA256:      sum,
+		Size:        len(data),
+		ContentType: resp.Header.Get("Content-Type"),
+		Status:      resp.StatusCode,
+		FetchedAt:   time.Now(),
+	}
+	return objPath, c.writeManifest(entry)
+}
+
+func (c *Crawler) writeManifest(entry ManifestEntry) error {
+	if c.manifestFile == nil {
+		os.MkdirAll(c.DestDir, os.ModePerm)
+		file, err := os.OpenFile(filepath.Join(c.DestDir, manifestFileName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		c.manifestFile = file
+	}
+	return json.NewEncoder(c.manifestFile).Encode(entry)
+}
+
+// Record in the manifest where the URL was saved if its path was
+// too long
+func (c *Crawler) recordLongPath(u *url.URL) error {
+	savePath, longPath := c.mappedPath(u)
+	if longPath == "" {
+		return nil
+	}
+	short, err1 := filepath.Rel(c.DestDir, savePath)
+	long, err2 := filepath.Rel(c.DestDir, longPath)
+	if err1 != nil || err2 != nil {
+		return nil
+	}
+	return c.writeManifest(ManifestEntry{
+		URL:       u.String(),
+		FetchedAt: time.Now(),
+		Path:      filepath.ToSlash(short),
+		LongPath:  filepath.ToSlash(long),
+	})
+}
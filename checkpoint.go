@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Snapshot of the crawl: what was visited, what was queued and how
+// long the append-only files were
+type checkpoint struct {
+	Number int            `json:"number"`
+	Time   time.Time      `json:"time"`
+	Pages  State          `json:"pages"`
+	Queue  []queueItem    `json:"queue"`
+	Spent  map[string]int `json:"spent,omitempty"`
+	// Size of the files only appended to, -1 if missing
+	Files map[string]int64 `json:"files"`
+}
+
+func checkpointDir(stateFile string) string {
+	return stateFile + ".checkpoints"
+}
+
+func checkpointFile(stateFile string, n int) string {
+	return filepath.Join(checkpointDir(stateFile), fmt.Sprintf("checkpoint-%d.json", n))
+}
+
+// Numbers of the checkpoints written so far, in increasing order
+func checkpointNumbers(stateFile string) []int {
+	files, _ := filepath.Glob(filepath.Join(checkpointDir(stateFile), "checkpoint-*.json"))
+	var numbers []int
+	for _, file := range files {
+		name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(file), "checkpoint-"), ".json")
+		if n, err := strconv.Atoi(name); err == nil {
+			numbers = append(numbers, n)
+		}
+	}
+	slices.Sort(numbers)
+	return numbers
+}
+
+// Files of the crawl that are only appended to
+func (c *Crawler) appendedFiles() []string {
+	files := []string{visitedLogFile(c.StateFile)}
+	for _, name := range []string{metaFileName, manifestFileName, checksumFileName, headersFileName, seoFileName, edgesFileName} {
+		files = append(files, filepath.Join(c.DestDir, name))
+	}
+	if c.OutlinksFile != "" {
+		files = append(files, c.OutlinksFile)
+	}
+	return files
+}
+
+// Write the next checkpoint
+func (c *Crawler) writeCheckpoint() error {
+	n := 1
+	if numbers := checkpointNumbers(c.StateFile); len(numbers) > 0 {
+		n = numbers[len(numbers)-1] + 1
+	}
+	cp := checkpoint{
+		Number: n,
+		Time:   time.Now(),
+		Pages:  c.state,
+		Queue:  c.queue.Items(),
+		Spent:  c.spent,
+		Files:  make(map[string]int64),
+	}
+	for _, file := range c.appendedFiles() {
+		cp.Files[file] = -1
+		if info, err := os.Stat(file); err == nil {
+			cp.Files[file] = info.Size()
+		}
+	}
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	file := checkpointFile(c.StateFile, n)
+	os.MkdirAll(filepath.Dir(file), os.ModePerm)
+	if err := os.WriteFile(file+".tmp", data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(file+".tmp", file); err != nil {
+		return err
+	}
+	fmt.Printf("Checkpoint %d written, %d pages visited and %d queued\n", n, len(cp.Pages), len(cp.Queue))
+	return nil
+}
+
+// Roll the crawl back to checkpoint n: the files saved since are
+// deleted, the append-only files truncated and the state replaced.
+// The later checkpoints are dropped.
+func (c *Crawler) restoreCheckpoint(n int) (*checkpoint, error) {
+	data, err := os.ReadFile(checkpointFile(c.StateFile, n))
+	if err != nil {
+		return nil, fmt.Errorf("checkpoint %d: %v", n, err)
+	}
+	var cp checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint %d: %v", n, err)
+	}
+	if cp.Pages == nil {
+		cp.Pages = make(State)
+	}
+
+	current, err := loadState(c.StateFile)
+	if err != nil {
+		return nil, err
+	}
+	if c.ShardState {
+		if err := loadStateShards(c.StateFile, current); err != nil {
+			return nil, err
+		}
+	}
+	if c.compactVisited() {
+		logFile := visitedLogFile(c.StateFile)
+		for url, rec := range visitedLogSince(logFile, max(cp.Files[logFile], 0)) {
+			current[url] = rec
+		}
+	}
+	// Objects of the cas store can be shared with older pages
+	kept := make(map[string]bool)
+	for _, rec := range cp.Pages {
+		if rec.SavePath != "" {
+			kept[rec.SavePath] = true
+		}
+	}
+	removed := 0
+	for url, rec := range current {
+		if _, ok := cp.Pages[url]; !ok && rec.SavePath != "" && !kept[rec.SavePath] {
+			if os.Remove(rec.SavePath) == nil {
+				removed++
+			}
+		}
+	}
+	for file, size := range cp.Files {
+		if size < 0 {
+			os.Remove(file)
+		} else if err := os.Truncate(file, size); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	if c.ShardState {
+		shards, _ := stateShardFiles(c.StateFile)
+		for _, file := range shards {
+			os.Remove(file)
+		}
+		for host, shard := range shardState(cp.Pages) {
+			if err := saveState(shard, shardStateFile(c.StateFile, host)); err != nil {
+				return nil, err
+			}
+		}
+	} else if err := saveState(cp.Pages, c.StateFile); err != nil {
+		return nil, err
+	}
+	for _, later := range checkpointNumbers(c.StateFile) {
+		if later > n {
+			os.Remove(checkpointFile(c.StateFile, later))
+		}
+	}
+	fmt.Printf("Restored checkpoint %d of %s, %d saved files removed\n", n, cp.Time.Format(time.RFC3339), removed)
+	return &cp, nil
+}
+
+// Records appended to the visited log after offset
+func visitedLogSince(logFile string, offset int64) State {
+	state := make(State)
+	file, err := os.Open(logFile)
+	if err != nil {
+		return state
+	}
+	defer file.Close()
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return state
+	}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry visitedEntry
+		if json.Unmarshal(scanner.Bytes(), &entry) == nil && entry.URL != "" {
+			state[entry.URL] = entry.PageRecord
+		}
+	}
+	return state
+}
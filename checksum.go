@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const checksumFileName = "SHA256SUMS"
+
+// Append the checksum of a saved file to SHA256SUMS
+func (c *Crawler) recordSum(savePath string, sum string) error {
+	if c.checksumFile == nil {
+		os.MkdirAll(c.DestDir, os.ModePerm)
+		file, err := os.OpenFile(filepath.Join(c.DestDir, checksumFileName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		c.checksumFile = file
+	}
+	rel, err := filepath.Rel(c.DestDir, savePath)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(c.checksumFile, "%s  %s\n", sum, filepath.ToSlash(rel))
+	return err
+}
+
+// Read SHA256SUMS, the last entry of a path wins
+func loadChecksums(dir string) (map[string]string, []string, error) {
+	file, err := os.Open(filepath.Join(dir, checksumFileName))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	sums := make(map[string]string)
+	var paths []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		sum, rel, ok := strings.Cut(scanner.Text(), "  ")
+		if !ok {
+			continue
+		}
+		if _, seen := sums[rel]; !seen {
+			paths = append(paths, rel)
+		}
+		sums[rel] = sum
+	}
+	return sums, paths, scanner.Err()
+}
+
+func hashFile(name string) (string, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// verify-local: re-hash the mirror and report corrupted or missing files
+func verifyLocal(args []string) error {
+	fs := flag.NewFlagSet("verify-local", flag.ExitOnError)
+	dir := fs.String("dir", "", "Directory of the mirror")
+	fs.Parse(args)
+	if *dir == "" {
+		return fmt.Errorf("use command verify-local -dir <directory>")
+	}
+
+	sums, paths, err := loadChecksums(*dir)
+	if err != nil {
+		return err
+	}
+	missing, corrupted := 0, 0
+	for _, rel := range paths {
+		sum, err := hashFile(filepath.Join(*dir, filepath.FromSlash(rel)))
+		if os.IsNotExist(err) {
+			fmt.Println("MISSING", rel)
+			missing++
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if sum != sums[rel] {
+			fmt.Println("CORRUPTED", rel)
+			corrupted++
+		}
+	}
+	fmt.Printf("Checked %d files: %d missing, %d corrupted\n", len(paths), missing, corrupted)
+	if missing > 0 || corrupted > 0 {
+		return fmt.Errorf("mirror %s failed verification", *dir)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Commands given to a running crawl from another goroutine
+type control struct {
+	mu     sync.Mutex
+	paused bool
+	// Hosts skipped, and the ones whose queued URLs are still to drop
+	skippedHosts map[string]bool
+	skipped      []string
+}
+
+func (c *control) setPaused(paused bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.paused = paused
+}
+
+func (c *control) isPaused() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.paused
+}
+
+// Drop the queued URLs of the host and don't queue it again
+func (c *control) skipHost(host string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.skippedHosts == nil {
+		c.skippedHosts = make(map[string]bool)
+	}
+	c.skippedHosts[host] = true
+	c.skipped = append(c.skipped, host)
+}
+
+func (c *control) hostSkipped(host string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.skippedHosts[host]
+}
+
+func (c *control) takeSkipped() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	skipped := c.skipped
+	c.skipped = nil
+	return skipped
+}
+
+// Block while the crawl is paused
+func (c *control) waitResumed(ctx context.Context) error {
+	for c.isPaused() {
+		select {
+		case <-time.After(200 * time.Millisecond):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,893 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        v5.29.3
+// source: crawler.proto
+
+package crawlerpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type JobState int32
+
+const (
+	JobState_JOB_STATE_UNSPECIFIED JobState = 0
+	JobState_JOB_STATE_RUNNING     JobState = 1
+	JobState_JOB_STATE_DONE        JobState = 2
+	JobState_JOB_STATE_FAILED      JobState = 3
+	JobState_JOB_STATE_CANCELED    JobState = 4
+	// Waiting for a free slot
+	JobState_JOB_STATE_QUEUED JobState = 5
+	JobState_JOB_STATE_PAUSED JobState = 6
+)
+
+// Enum value maps for JobState.
+var (
+	JobState_name = map[int32]string{
+		0: "JOB_STATE_UNSPECIFIED",
+		1: "JOB_STATE_RUNNING",
+		2: "JOB_STATE_DONE",
+		3: "JOB_STATE_FAILED",
+		4: "JOB_STATE_CANCELED",
+		5: "JOB_STATE_QUEUED",
+		6: "JOB_STATE_PAUSED",
+	}
+	JobState_value = map[string]int32{
+		"JOB_STATE_UNSPECIFIED": 0,
+		"JOB_STATE_RUNNING":     1,
+		"JOB_STATE_DONE":        2,
+		"JOB_STATE_FAILED":      3,
+		"JOB_STATE_CANCELED":    4,
+		"JOB_STATE_QUEUED":      5,
+		"JOB_STATE_PAUSED":      6,
+	}
+)
+
+func (x JobState) Enum() *JobState {
+	p := new(JobState)
+	*p = x
+	return p
+}
+
+func (x JobState) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (JobState) Descriptor() protoreflect.EnumDescriptor {
+	return file_crawler_proto_enumTypes[0].Descriptor()
+}
+
+func (JobState) Type() protoreflect.EnumType {
+	return &file_crawler_proto_enumTypes[0]
+}
+
+func (x JobState) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use JobState.Descriptor instead.
+func (JobState) EnumDescriptor() ([]byte, []int) {
+	return file_crawler_proto_rawDescGZIP(), []int{0}
+}
+
+type StartCrawlRequest struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	StartUrl string                 `protobuf:"bytes,1,opt,name=start_url,json=startUrl,proto3" json:"start_url,omitempty"`
+	Dir      string                 `protobuf:"bytes,2,opt,name=dir,proto3" json:"dir,omitempty"`
+	// Other flags, e.g. ["-assets", "-delay", "1s"]; the state file
+	// defaults to state.json in dir
+	Args          []string   `protobuf:"bytes,3,rep,name=args,proto3" json:"args,omitempty"`
+	Limits        *JobLimits `protobuf:"bytes,4,opt,name=limits,proto3" json:"limits,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StartCrawlRequest) Reset() {
+	*x = StartCrawlRequest{}
+	mi := &file_crawler_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StartCrawlRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StartCrawlRequest) ProtoMessage() {}
+
+func (x *StartCrawlRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_crawler_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StartCrawlRequest.ProtoReflect.Descriptor instead.
+func (*StartCrawlRequest) Descriptor() ([]byte, []int) {
+	return file_crawler_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *StartCrawlRequest) GetStartUrl() string {
+	if x != nil {
+		return x.StartUrl
+	}
+	return ""
+}
+
+func (x *StartCrawlRequest) GetDir() string {
+	if x != nil {
+		return x.Dir
+	}
+	return ""
+}
+
+func (x *StartCrawlRequest) GetArgs() []string {
+	if x != nil {
+		return x.Args
+	}
+	return nil
+}
+
+func (x *StartCrawlRequest) GetLimits() *JobLimits {
+	if x != nil {
+		return x.Limits
+	}
+	return nil
+}
+
+// The job is stopped when a limit is reached, 0 for no limit
+type JobLimits struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	MaxPages      int64                  `protobuf:"varint,1,opt,name=max_pages,json=maxPages,proto3" json:"max_pages,omitempty"`
+	MaxBytes      int64                  `protobuf:"varint,2,opt,name=max_bytes,json=maxBytes,proto3" json:"max_bytes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *JobLimits) Reset() {
+	*x = JobLimits{}
+	mi := &file_crawler_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *JobLimits) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*JobLimits) ProtoMessage() {}
+
+func (x *JobLimits) ProtoReflect() protoreflect.Message {
+	mi := &file_crawler_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use JobLimits.ProtoReflect.Descriptor instead.
+func (*JobLimits) Descriptor() ([]byte, []int) {
+	return file_crawler_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *JobLimits) GetMaxPages() int64 {
+	if x != nil {
+		return x.MaxPages
+	}
+	return 0
+}
+
+func (x *JobLimits) GetMaxBytes() int64 {
+	if x != nil {
+		return x.MaxBytes
+	}
+	return 0
+}
+
+type Job struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Id       string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	StartUrl string                 `protobuf:"bytes,2,opt,name=start_url,json=startUrl,proto3" json:"start_url,omitempty"`
+	State    JobState               `protobuf:"varint,3,opt,name=state,proto3,enum=crawler.v1.JobState" json:"state,omitempty"`
+	Error    string                 `protobuf:"bytes,4,opt,name=error,proto3" json:"error,omitempty"`
+	// What the crawl is doing and the URL it is on
+	Stage         string     `protobuf:"bytes,5,opt,name=stage,proto3" json:"stage,omitempty"`
+	Url           string     `protobuf:"bytes,6,opt,name=url,proto3" json:"url,omitempty"`
+	Queued        int64      `protobuf:"varint,7,opt,name=queued,proto3" json:"queued,omitempty"`
+	Crawled       int64      `protobuf:"varint,8,opt,name=crawled,proto3" json:"crawled,omitempty"`
+	Bytes         int64      `protobuf:"varint,9,opt,name=bytes,proto3" json:"bytes,omitempty"`
+	Limits        *JobLimits `protobuf:"bytes,10,opt,name=limits,proto3" json:"limits,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Job) Reset() {
+	*x = Job{}
+	mi := &file_crawler_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Job) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Job) ProtoMessage() {}
+
+func (x *Job) ProtoReflect() protoreflect.Message {
+	mi := &file_crawler_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Job.ProtoReflect.Descriptor instead.
+func (*Job) Descriptor() ([]byte, []int) {
+	return file_crawler_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Job) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Job) GetStartUrl() string {
+	if x != nil {
+		return x.StartUrl
+	}
+	return ""
+}
+
+func (x *Job) GetState() JobState {
+	if x != nil {
+		return x.State
+	}
+	return JobState_JOB_STATE_UNSPECIFIED
+}
+
+func (x *Job) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *Job) GetStage() string {
+	if x != nil {
+		return x.Stage
+	}
+	return ""
+}
+
+func (x *Job) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *Job) GetQueued() int64 {
+	if x != nil {
+		return x.Queued
+	}
+	return 0
+}
+
+func (x *Job) GetCrawled() int64 {
+	if x != nil {
+		return x.Crawled
+	}
+	return 0
+}
+
+func (x *Job) GetBytes() int64 {
+	if x != nil {
+		return x.Bytes
+	}
+	return 0
+}
+
+func (x *Job) GetLimits() *JobLimits {
+	if x != nil {
+		return x.Limits
+	}
+	return nil
+}
+
+type ListJobsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListJobsRequest) Reset() {
+	*x = ListJobsRequest{}
+	mi := &file_crawler_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListJobsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListJobsRequest) ProtoMessage() {}
+
+func (x *ListJobsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_crawler_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListJobsRequest.ProtoReflect.Descriptor instead.
+func (*ListJobsRequest) Descriptor() ([]byte, []int) {
+	return file_crawler_proto_rawDescGZIP(), []int{3}
+}
+
+type ListJobsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Jobs          []*Job                 `protobuf:"bytes,1,rep,name=jobs,proto3" json:"jobs,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListJobsResponse) Reset() {
+	*x = ListJobsResponse{}
+	mi := &file_crawler_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListJobsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListJobsResponse) ProtoMessage() {}
+
+func (x *ListJobsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_crawler_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListJobsResponse.ProtoReflect.Descriptor instead.
+func (*ListJobsResponse) Descriptor() ([]byte, []int) {
+	return file_crawler_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ListJobsResponse) GetJobs() []*Job {
+	if x != nil {
+		return x.Jobs
+	}
+	return nil
+}
+
+type PauseRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PauseRequest) Reset() {
+	*x = PauseRequest{}
+	mi := &file_crawler_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PauseRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PauseRequest) ProtoMessage() {}
+
+func (x *PauseRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_crawler_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PauseRequest.ProtoReflect.Descriptor instead.
+func (*PauseRequest) Descriptor() ([]byte, []int) {
+	return file_crawler_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *PauseRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type ResumeRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ResumeRequest) Reset() {
+	*x = ResumeRequest{}
+	mi := &file_crawler_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ResumeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ResumeRequest) ProtoMessage() {}
+
+func (x *ResumeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_crawler_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ResumeRequest.ProtoReflect.Descriptor instead.
+func (*ResumeRequest) Descriptor() ([]byte, []int) {
+	return file_crawler_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ResumeRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type GetStatusRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetStatusRequest) Reset() {
+	*x = GetStatusRequest{}
+	mi := &file_crawler_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetStatusRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetStatusRequest) ProtoMessage() {}
+
+func (x *GetStatusRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_crawler_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetStatusRequest.ProtoReflect.Descriptor instead.
+func (*GetStatusRequest) Descriptor() ([]byte, []int) {
+	return file_crawler_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *GetStatusRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type CancelRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CancelRequest) Reset() {
+	*x = CancelRequest{}
+	mi := &file_crawler_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CancelRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CancelRequest) ProtoMessage() {}
+
+func (x *CancelRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_crawler_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CancelRequest.ProtoReflect.Descriptor instead.
+func (*CancelRequest) Descriptor() ([]byte, []int) {
+	return file_crawler_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *CancelRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type WatchEventsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchEventsRequest) Reset() {
+	*x = WatchEventsRequest{}
+	mi := &file_crawler_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchEventsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchEventsRequest) ProtoMessage() {}
+
+func (x *WatchEventsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_crawler_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchEventsRequest.ProtoReflect.Descriptor instead.
+func (*WatchEventsRequest) Descriptor() ([]byte, []int) {
+	return file_crawler_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *WatchEventsRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type PageEvent struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	JobId    string                 `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+	Url      string                 `protobuf:"bytes,2,opt,name=url,proto3" json:"url,omitempty"`
+	Status   int32                  `protobuf:"varint,3,opt,name=status,proto3" json:"status,omitempty"`
+	Referrer string                 `protobuf:"bytes,4,opt,name=referrer,proto3" json:"referrer,omitempty"`
+	Depth    int32                  `protobuf:"varint,5,opt,name=depth,proto3" json:"depth,omitempty"`
+	SavePath string                 `protobuf:"bytes,6,opt,name=save_path,json=savePath,proto3" json:"save_path,omitempty"`
+	Hash     string                 `protobuf:"bytes,7,opt,name=hash,proto3" json:"hash,omitempty"`
+	Size     int64                  `protobuf:"varint,8,opt,name=size,proto3" json:"size,omitempty"`
+	// Set when the URL redirects to another one
+	AliasOf       string                 `protobuf:"bytes,9,opt,name=alias_of,json=aliasOf,proto3" json:"alias_of,omitempty"`
+	FetchedAt     *timestamppb.Timestamp `protobuf:"bytes,10,opt,name=fetched_at,json=fetchedAt,proto3" json:"fetched_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PageEvent) Reset() {
+	*x = PageEvent{}
+	mi := &file_crawler_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PageEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PageEvent) ProtoMessage() {}
+
+func (x *PageEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_crawler_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PageEvent.ProtoReflect.Descriptor instead.
+func (*PageEvent) Descriptor() ([]byte, []int) {
+	return file_crawler_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *PageEvent) GetJobId() string {
+	if x != nil {
+		return x.JobId
+	}
+	return ""
+}
+
+func (x *PageEvent) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *PageEvent) GetStatus() int32 {
+	if x != nil {
+		return x.Status
+	}
+	return 0
+}
+
+func (x *PageEvent) GetReferrer() string {
+	if x != nil {
+		return x.Referrer
+	}
+	return ""
+}
+
+func (x *PageEvent) GetDepth() int32 {
+	if x != nil {
+		return x.Depth
+	}
+	return 0
+}
+
+func (x *PageEvent) GetSavePath() string {
+	if x != nil {
+		return x.SavePath
+	}
+	return ""
+}
+
+func (x *PageEvent) GetHash() string {
+	if x != nil {
+		return x.Hash
+	}
+	return ""
+}
+
+func (x *PageEvent) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *PageEvent) GetAliasOf() string {
+	if x != nil {
+		return x.AliasOf
+	}
+	return ""
+}
+
+func (x *PageEvent) GetFetchedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.FetchedAt
+	}
+	return nil
+}
+
+var File_crawler_proto protoreflect.FileDescriptor
+
+const file_crawler_proto_rawDesc = "" +
+	"\n" +
+	"\rcrawler.proto\x12\n" +
+	"crawler.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\x85\x01\n" +
+	"\x11StartCrawlRequest\x12\x1b\n" +
+	"\tstart_url\x18\x01 \x01(\tR\bstartUrl\x12\x10\n" +
+	"\x03dir\x18\x02 \x01(\tR\x03dir\x12\x12\n" +
+	"\x04args\x18\x03 \x03(\tR\x04args\x12-\n" +
+	"\x06limits\x18\x04 \x01(\v2\x15.crawler.v1.JobLimitsR\x06limits\"E\n" +
+	"\tJobLimits\x12\x1b\n" +
+	"\tmax_pages\x18\x01 \x01(\x03R\bmaxPages\x12\x1b\n" +
+	"\tmax_bytes\x18\x02 \x01(\x03R\bmaxBytes\"\x93\x02\n" +
+	"\x03Job\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1b\n" +
+	"\tstart_url\x18\x02 \x01(\tR\bstartUrl\x12*\n" +
+	"\x05state\x18\x03 \x01(\x0e2\x14.crawler.v1.JobStateR\x05state\x12\x14\n" +
+	"\x05error\x18\x04 \x01(\tR\x05error\x12\x14\n" +
+	"\x05stage\x18\x05 \x01(\tR\x05stage\x12\x10\n" +
+	"\x03url\x18\x06 \x01(\tR\x03url\x12\x16\n" +
+	"\x06queued\x18\a \x01(\x03R\x06queued\x12\x18\n" +
+	"\acrawled\x18\b \x01(\x03R\acrawled\x12\x14\n" +
+	"\x05bytes\x18\t \x01(\x03R\x05bytes\x12-\n" +
+	"\x06limits\x18\n" +
+	" \x01(\v2\x15.crawler.v1.JobLimitsR\x06limits\"\x11\n" +
+	"\x0fListJobsRequest\"7\n" +
+	"\x10ListJobsResponse\x12#\n" +
+	"\x04jobs\x18\x01 \x03(\v2\x0f.crawler.v1.JobR\x04jobs\"\x1e\n" +
+	"\fPauseRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"\x1f\n" +
+	"\rResumeRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"\"\n" +
+	"\x10GetStatusRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"\x1f\n" +
+	"\rCancelRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"$\n" +
+	"\x12WatchEventsRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"\x99\x02\n" +
+	"\tPageEvent\x12\x15\n" +
+	"\x06job_id\x18\x01 \x01(\tR\x05jobId\x12\x10\n" +
+	"\x03url\x18\x02 \x01(\tR\x03url\x12\x16\n" +
+	"\x06status\x18\x03 \x01(\x05R\x06status\x12\x1a\n" +
+	"\breferrer\x18\x04 \x01(\tR\breferrer\x12\x14\n" +
+	"\x05depth\x18\x05 \x01(\x05R\x05depth\x12\x1b\n" +
+	"\tsave_path\x18\x06 \x01(\tR\bsavePath\x12\x12\n" +
+	"\x04hash\x18\a \x01(\tR\x04hash\x12\x12\n" +
+	"\x04size\x18\b \x01(\x03R\x04size\x12\x19\n" +
+	"\balias_of\x18\t \x01(\tR\aaliasOf\x129\n" +
+	"\n" +
+	"fetched_at\x18\n" +
+	" \x01(\v2\x1a.google.protobuf.TimestampR\tfetchedAt*\xaa\x01\n" +
+	"\bJobState\x12\x19\n" +
+	"\x15JOB_STATE_UNSPECIFIED\x10\x00\x12\x15\n" +
+	"\x11JOB_STATE_RUNNING\x10\x01\x12\x12\n" +
+	"\x0eJOB_STATE_DONE\x10\x02\x12\x14\n" +
+	"\x10JOB_STATE_FAILED\x10\x03\x12\x16\n" +
+	"\x12JOB_STATE_CANCELED\x10\x04\x12\x14\n" +
+	"\x10JOB_STATE_QUEUED\x10\x05\x12\x14\n" +
+	"\x10JOB_STATE_PAUSED\x10\x062\xb2\x03\n" +
+	"\aCrawler\x12<\n" +
+	"\n" +
+	"StartCrawl\x12\x1d.crawler.v1.StartCrawlRequest\x1a\x0f.crawler.v1.Job\x12:\n" +
+	"\tGetStatus\x12\x1c.crawler.v1.GetStatusRequest\x1a\x0f.crawler.v1.Job\x12E\n" +
+	"\bListJobs\x12\x1b.crawler.v1.ListJobsRequest\x1a\x1c.crawler.v1.ListJobsResponse\x122\n" +
+	"\x05Pause\x12\x18.crawler.v1.PauseRequest\x1a\x0f.crawler.v1.Job\x124\n" +
+	"\x06Resume\x12\x19.crawler.v1.ResumeRequest\x1a\x0f.crawler.v1.Job\x124\n" +
+	"\x06Cancel\x12\x19.crawler.v1.CancelRequest\x1a\x0f.crawler.v1.Job\x12F\n" +
+	"\vWatchEvents\x12\x1e.crawler.v1.WatchEventsRequest\x1a\x15.crawler.v1.PageEvent0\x01B#Z!github.com/niqt/crawler/crawlerpbb\x06proto3"
+
+var (
+	file_crawler_proto_rawDescOnce sync.Once
+	file_crawler_proto_rawDescData []byte
+)
+
+func file_crawler_proto_rawDescGZIP() []byte {
+	file_crawler_proto_rawDescOnce.Do(func() {
+		file_crawler_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_crawler_proto_rawDesc), len(file_crawler_proto_rawDesc)))
+	})
+	return file_crawler_proto_rawDescData
+}
+
+var file_crawler_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_crawler_proto_msgTypes = make([]protoimpl.MessageInfo, 11)
+var file_crawler_proto_goTypes = []any{
+	(JobState)(0),                 // 0: crawler.v1.JobState
+	(*StartCrawlRequest)(nil),     // 1: crawler.v1.StartCrawlRequest
+	(*JobLimits)(nil),             // 2: crawler.v1.JobLimits
+	(*Job)(nil),                   // 3: crawler.v1.Job
+	(*ListJobsRequest)(nil),       // 4: crawler.v1.ListJobsRequest
+	(*ListJobsResponse)(nil),      // 5: crawler.v1.ListJobsResponse
+	(*PauseRequest)(nil),          // 6: crawler.v1.PauseRequest
+	(*ResumeRequest)(nil),         // 7: crawler.v1.ResumeRequest
+	(*GetStatusRequest)(nil),      // 8: crawler.v1.GetStatusRequest
+	(*CancelRequest)(nil),         // 9: crawler.v1.CancelRequest
+	(*WatchEventsRequest)(nil),    // 10: crawler.v1.WatchEventsRequest
+	(*PageEvent)(nil),             // 11: crawler.v1.PageEvent
+	(*timestamppb.Timestamp)(nil), // 12: google.protobuf.Timestamp
+}
+var file_crawler_proto_depIdxs = []int32{
+	2,  // 0: crawler.v1.StartCrawlRequest.limits:type_name -> crawler.v1.JobLimits
+	0,  // 1: crawler.v1.Job.state:type_name -> crawler.v1.JobState
+	2,  // 2: crawler.v1.Job.limits:type_name -> crawler.v1.JobLimits
+	3,  // 3: crawler.v1.ListJobsResponse.jobs:type_name -> crawler.v1.Job
+	12, // 4: crawler.v1.PageEvent.fetched_at:type_name -> google.protobuf.Timestamp
+	1,  // 5: crawler.v1.Crawler.StartCrawl:input_type -> crawler.v1.StartCrawlRequest
+	8,  // 6: crawler.v1.Crawler.GetStatus:input_type -> crawler.v1.GetStatusRequest
+	4,  // 7: crawler.v1.Crawler.ListJobs:input_type -> crawler.v1.ListJobsRequest
+	6,  // 8: crawler.v1.Crawler.Pause:input_type -> crawler.v1.PauseRequest
+	7,  // 9: crawler.v1.Crawler.Resume:input_type -> crawler.v1.ResumeRequest
+	9,  // 10: crawler.v1.Crawler.Cancel:input_type -> crawler.v1.CancelRequest
+	10, // 11: crawler.v1.Crawler.WatchEvents:input_type -> crawler.v1.WatchEventsRequest
+	3,  // 12: crawler.v1.Crawler.StartCrawl:output_type -> crawler.v1.Job
+	3,  // 13: crawler.v1.Crawler.GetStatus:output_type -> crawler.v1.Job
+	5,  // 14: crawler.v1.Crawler.ListJobs:output_type -> crawler.v1.ListJobsResponse
+	3,  // 15: crawler.v1.Crawler.Pause:output_type -> crawler.v1.Job
+	3,  // 16: crawler.v1.Crawler.Resume:output_type -> crawler.v1.Job
+	3,  // 17: crawler.v1.Crawler.Cancel:output_type -> crawler.v1.Job
+	11, // 18: crawler.v1.Crawler.WatchEvents:output_type -> crawler.v1.PageEvent
+	12, // [12:19] is the sub-list for method output_type
+	5,  // [5:12] is the sub-list for method input_type
+	5,  // [5:5] is the sub-list for extension type_name
+	5,  // [5:5] is the sub-list for extension extendee
+	0,  // [0:5] is the sub-list for field type_name
+}
+
+func init() { file_crawler_proto_init() }
+func file_crawler_proto_init() {
+	if File_crawler_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_crawler_proto_rawDesc), len(file_crawler_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   11,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_crawler_proto_goTypes,
+		DependencyIndexes: file_crawler_proto_depIdxs,
+		EnumInfos:         file_crawler_proto_enumTypes,
+		MessageInfos:      file_crawler_proto_msgTypes,
+	}.Build()
+	File_crawler_proto = out.File
+	file_crawler_proto_goTypes = nil
+	file_crawler_proto_depIdxs = nil
+}
@@ -0,0 +1,361 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             v5.29.3
+// source: crawler.proto
+
+package crawlerpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Crawler_StartCrawl_FullMethodName  = "/crawler.v1.Crawler/StartCrawl"
+	Crawler_GetStatus_FullMethodName   = "/crawler.v1.Crawler/GetStatus"
+	Crawler_ListJobs_FullMethodName    = "/crawler.v1.Crawler/ListJobs"
+	Crawler_Pause_FullMethodName       = "/crawler.v1.Crawler/Pause"
+	Crawler_Resume_FullMethodName      = "/crawler.v1.Crawler/Resume"
+	Crawler_Cancel_FullMethodName      = "/crawler.v1.Crawler/Cancel"
+	Crawler_WatchEvents_FullMethodName = "/crawler.v1.Crawler/WatchEvents"
+)
+
+// CrawlerClient is the client API for Crawler service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Control of the crawls run by the daemon
+type CrawlerClient interface {
+	// Start a crawl; the options are the flags of the crawler command
+	StartCrawl(ctx context.Context, in *StartCrawlRequest, opts ...grpc.CallOption) (*Job, error)
+	GetStatus(ctx context.Context, in *GetStatusRequest, opts ...grpc.CallOption) (*Job, error)
+	ListJobs(ctx context.Context, in *ListJobsRequest, opts ...grpc.CallOption) (*ListJobsResponse, error)
+	Pause(ctx context.Context, in *PauseRequest, opts ...grpc.CallOption) (*Job, error)
+	Resume(ctx context.Context, in *ResumeRequest, opts ...grpc.CallOption) (*Job, error)
+	Cancel(ctx context.Context, in *CancelRequest, opts ...grpc.CallOption) (*Job, error)
+	// Stream the pages fetched by a crawl until it ends
+	WatchEvents(ctx context.Context, in *WatchEventsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[PageEvent], error)
+}
+
+type crawlerClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCrawlerClient(cc grpc.ClientConnInterface) CrawlerClient {
+	return &crawlerClient{cc}
+}
+
+func (c *crawlerClient) StartCrawl(ctx context.Context, in *StartCrawlRequest, opts ...grpc.CallOption) (*Job, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Job)
+	err := c.cc.Invoke(ctx, Crawler_StartCrawl_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *crawlerClient) GetStatus(ctx context.Context, in *GetStatusRequest, opts ...grpc.CallOption) (*Job, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Job)
+	err := c.cc.Invoke(ctx, Crawler_GetStatus_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *crawlerClient) ListJobs(ctx context.Context, in *ListJobsRequest, opts ...grpc.CallOption) (*ListJobsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListJobsResponse)
+	err := c.cc.Invoke(ctx, Crawler_ListJobs_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *crawlerClient) Pause(ctx context.Context, in *PauseRequest, opts ...grpc.CallOption) (*Job, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Job)
+	err := c.cc.Invoke(ctx, Crawler_Pause_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *crawlerClient) Resume(ctx context.Context, in *ResumeRequest, opts ...grpc.CallOption) (*Job, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Job)
+	err := c.cc.Invoke(ctx, Crawler_Resume_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *crawlerClient) Cancel(ctx context.Context, in *CancelRequest, opts ...grpc.CallOption) (*Job, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Job)
+	err := c.cc.Invoke(ctx, Crawler_Cancel_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *crawlerClient) WatchEvents(ctx context.Context, in *WatchEventsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[PageEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Crawler_ServiceDesc.Streams[0], Crawler_WatchEvents_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchEventsRequest, PageEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Crawler_WatchEventsClient = grpc.ServerStreamingClient[PageEvent]
+
+// CrawlerServer is the server API for Crawler service.
+// All implementations must embed UnimplementedCrawlerServer
+// for forward compatibility.
+//
+// Control of the crawls run by the daemon
+type CrawlerServer interface {
+	// Start a crawl; the options are the flags of the crawler command
+	StartCrawl(context.Context, *StartCrawlRequest) (*Job, error)
+	GetStatus(context.Context, *GetStatusRequest) (*Job, error)
+	ListJobs(context.Context, *ListJobsRequest) (*ListJobsResponse, error)
+	Pause(context.Context, *PauseRequest) (*Job, error)
+	Resume(context.Context, *ResumeRequest) (*Job, error)
+	Cancel(context.Context, *CancelRequest) (*Job, error)
+	// Stream the pages fetched by a crawl until it ends
+	WatchEvents(*WatchEventsRequest, grpc.ServerStreamingServer[PageEvent]) error
+	mustEmbedUnimplementedCrawlerServer()
+}
+
+// UnimplementedCrawlerServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedCrawlerServer struct{}
+
+func (UnimplementedCrawlerServer) StartCrawl(context.Context, *StartCrawlRequest) (*Job, error) {
+	return nil, status.Error(codes.Unimplemented, "method StartCrawl not implemented")
+}
+func (UnimplementedCrawlerServer) GetStatus(context.Context, *GetStatusRequest) (*Job, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetStatus not implemented")
+}
+func (UnimplementedCrawlerServer) ListJobs(context.Context, *ListJobsRequest) (*ListJobsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method ListJobs not implemented")
+}
+func (UnimplementedCrawlerServer) Pause(context.Context, *PauseRequest) (*Job, error) {
+	return nil, status.Error(codes.Unimplemented, "method Pause not implemented")
+}
+func (UnimplementedCrawlerServer) Resume(context.Context, *ResumeRequest) (*Job, error) {
+	return nil, status.Error(codes.Unimplemented, "method Resume not implemented")
+}
+func (UnimplementedCrawlerServer) Cancel(context.Context, *CancelRequest) (*Job, error) {
+	return nil, status.Error(codes.Unimplemented, "method Cancel not implemented")
+}
+func (UnimplementedCrawlerServer) WatchEvents(*WatchEventsRequest, grpc.ServerStreamingServer[PageEvent]) error {
+	return status.Error(codes.Unimplemented, "method WatchEvents not implemented")
+}
+func (UnimplementedCrawlerServer) mustEmbedUnimplementedCrawlerServer() {}
+func (UnimplementedCrawlerServer) testEmbeddedByValue()                 {}
+
+// UnsafeCrawlerServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CrawlerServer will
+// result in compilation errors.
+type UnsafeCrawlerServer interface {
+	mustEmbedUnimplementedCrawlerServer()
+}
+
+func RegisterCrawlerServer(s grpc.ServiceRegistrar, srv CrawlerServer) {
+	// If the following call panics, it indicates UnimplementedCrawlerServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Crawler_ServiceDesc, srv)
+}
+
+func _Crawler_StartCrawl_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StartCrawlRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CrawlerServer).StartCrawl(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Crawler_StartCrawl_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CrawlerServer).StartCrawl(ctx, req.(*StartCrawlRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Crawler_GetStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CrawlerServer).GetStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Crawler_GetStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CrawlerServer).GetStatus(ctx, req.(*GetStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Crawler_ListJobs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListJobsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CrawlerServer).ListJobs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Crawler_ListJobs_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CrawlerServer).ListJobs(ctx, req.(*ListJobsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Crawler_Pause_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PauseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CrawlerServer).Pause(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Crawler_Pause_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CrawlerServer).Pause(ctx, req.(*PauseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Crawler_Resume_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ResumeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CrawlerServer).Resume(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Crawler_Resume_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CrawlerServer).Resume(ctx, req.(*ResumeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Crawler_Cancel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CancelRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CrawlerServer).Cancel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Crawler_Cancel_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CrawlerServer).Cancel(ctx, req.(*CancelRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Crawler_WatchEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchEventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CrawlerServer).WatchEvents(m, &grpc.GenericServerStream[WatchEventsRequest, PageEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Crawler_WatchEventsServer = grpc.ServerStreamingServer[PageEvent]
+
+// Crawler_ServiceDesc is the grpc.ServiceDesc for Crawler service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Crawler_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "crawler.v1.Crawler",
+	HandlerType: (*CrawlerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "StartCrawl",
+			Handler:    _Crawler_StartCrawl_Handler,
+		},
+		{
+			MethodName: "GetStatus",
+			Handler:    _Crawler_GetStatus_Handler,
+		},
+		{
+			MethodName: "ListJobs",
+			Handler:    _Crawler_ListJobs_Handler,
+		},
+		{
+			MethodName: "Pause",
+			Handler:    _Crawler_Pause_Handler,
+		},
+		{
+			MethodName: "Resume",
+			Handler:    _Crawler_Resume_Handler,
+		},
+		{
+			MethodName: "Cancel",
+			Handler:    _Crawler_Cancel_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchEvents",
+			Handler:       _Crawler_WatchEvents_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "crawler.proto",
+}
@@ -0,0 +1,4 @@
+// Package crawlerpb holds the gRPC API of the crawler daemon
+package crawlerpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative crawler.proto
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	cssURLPattern    = regexp.MustCompile(`url\(\s*(?:'([^']*)'|"([^"]*)"|([^)'"\s]*))\s*\)`)
+	cssImportPattern = regexp.MustCompile(`@import\s+(?:'([^']*)'|"([^"]*)")`)
+)
+
+func isStylesheet(resp *http.Response, u *url.URL) bool {
+	return strings.HasPrefix(resp.Header.Get("Content-Type"), "text/css") || path.Ext(u.Path) == ".css"
+}
+
+// Queue the resources referenced by url(...) and @import and
+// rewrite them to the paths where they are saved
+func (c *Crawler) processStylesheet(data []byte, base *url.URL, savePath string, depth int) []byte {
+	rewrite := func(pattern *regexp.Regexp, format string) func([]byte) []byte {
+		return func(match []byte) []byte {
+			groups := pattern.FindSubmatch(match)
+			ref := ""
+			for _, g := range groups[1:] {
+				if len(g) > 0 {
+					ref = string(g)
+					break
+				}
+			}
+			local, ok := c.queueStylesheetRef(ref, base, savePath, depth)
+			if !ok {
+				return match
+			}
+			return []byte(strings.Replace(format, "%s", local, 1))
+		}
+	}
+	data = cssImportPattern.ReplaceAllFunc(data, rewrite(cssImportPattern, `@import "%s"`))
+	return cssURLPattern.ReplaceAllFunc(data, rewrite(cssURLPattern, `url("%s")`))
+}
+
+// Queue a resource of the stylesheet and return its path relative
+// to the stylesheet, or like wget its absolute URL when it was not
+// queued
+func (c *Crawler) queueStylesheetRef(ref string, base *url.URL, savePath string, depth int) (string, bool) {
+	ref, ok := c.filterLink(ref)
+	if !ok {
+		return "", false
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return "", false
+	}
+	u := base.ResolveReference(r)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", false
+	}
+	c.normalize(u)
+	c.enqueue(queueItem{URL: u.String(), Referrer: base.String(), Asset: true, Depth: depth})
+	if key := u.String(); !c.queued.Has(key) && !c.visited.Has(key) {
+		return key, true
+	}
+
+	rel, err := filepath.Rel(filepath.Dir(savePath), c.localPath(u))
+	if err != nil {
+		return u.String(), true
+	}
+	return escapeLocalPath(rel), true
+}
+
+// Relative URL of a local path: the names may hold "%" and other
+// characters to escape
+func escapeLocalPath(rel string) string {
+	return (&url.URL{Path: filepath.ToSlash(rel)}).EscapedPath()
+}
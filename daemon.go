@@ -0,0 +1,387 @@
+//go:build grpc
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/niqt/crawler/crawlerpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Events buffered for each watcher; a watcher falling further behind
+// loses events rather than slowing down the crawl
+const watchBuffer = 256
+
+var errJobLimit = errors.New("job limit reached")
+
+// Crawl run by the daemon
+type daemonJob struct {
+	id      string
+	crawler *Crawler
+	opts    runOptions
+	limits  *crawlerpb.JobLimits
+
+	mu       sync.Mutex
+	state    crawlerpb.JobState
+	err      error
+	cancel   context.CancelCauseFunc
+	pages    int64
+	bytes    int64
+	watchers map[chan *crawlerpb.PageEvent]bool
+}
+
+func (j *daemonJob) publish(urlStr string, rec PageRecord) {
+	event := &crawlerpb.PageEvent{
+		JobId:    j.id,
+		Url:      urlStr,
+		Status:   int32(rec.Status),
+		Referrer: rec.Referrer,
+		Depth:    int32(rec.Depth),
+		SavePath: rec.SavePath,
+		Hash:     rec.Hash,
+		Size:     rec.Size,
+		AliasOf:  rec.AliasOf,
+	}
+	if !rec.FetchedAt.IsZero() {
+		event.FetchedAt = timestamppb.New(rec.FetchedAt)
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if rec.SavePath != "" {
+		j.pages++
+		j.bytes += rec.Size
+		if (j.limits.GetMaxPages() > 0 && j.pages >= j.limits.GetMaxPages()) ||
+			(j.limits.GetMaxBytes() > 0 && j.bytes >= j.limits.GetMaxBytes()) {
+			j.cancel(errJobLimit)
+		}
+	}
+	for ch := range j.watchers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+func (j *daemonJob) over() bool {
+	switch j.state {
+	case crawlerpb.JobState_JOB_STATE_DONE, crawlerpb.JobState_JOB_STATE_FAILED, crawlerpb.JobState_JOB_STATE_CANCELED:
+		return true
+	}
+	return false
+}
+
+// Channel receiving the events of the job, nil if it is over
+func (j *daemonJob) watch() chan *crawlerpb.PageEvent {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.over() {
+		return nil
+	}
+	ch := make(chan *crawlerpb.PageEvent, watchBuffer)
+	j.watchers[ch] = true
+	return ch
+}
+
+func (j *daemonJob) unwatch(ch chan *crawlerpb.PageEvent) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.watchers[ch] {
+		delete(j.watchers, ch)
+		close(ch)
+	}
+}
+
+func (j *daemonJob) closeWatchers() {
+	for ch := range j.watchers {
+		delete(j.watchers, ch)
+		close(ch)
+	}
+}
+
+// Run the crawl in background, calling done when it ends
+func (j *daemonJob) start(parent context.Context, done func()) {
+	ctx, cancel := context.WithCancelCause(parent)
+	crawlCtx, stop := ctx, context.CancelFunc(func() {})
+	if j.opts.CrawlTimeout > 0 {
+		crawlCtx, stop = context.WithTimeout(ctx, j.opts.CrawlTimeout)
+	}
+	j.mu.Lock()
+	j.state, j.cancel = crawlerpb.JobState_JOB_STATE_RUNNING, cancel
+	j.mu.Unlock()
+	go func() {
+		_, err := j.crawler.crawl(crawlCtx, j.crawler.StartURL)
+		j.finish(ctx, err)
+		stop()
+		cancel(nil)
+		done()
+	}()
+}
+
+// Record how the crawl ended and close the watchers
+func (j *daemonJob) finish(ctx context.Context, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	switch {
+	case err == nil || context.Cause(ctx) == errJobLimit:
+		j.state = crawlerpb.JobState_JOB_STATE_DONE
+	case context.Cause(ctx) == context.Canceled:
+		j.state = crawlerpb.JobState_JOB_STATE_CANCELED
+	default:
+		fmt.Printf("Job %s failed: %v\n", j.id, err)
+		j.state, j.err = crawlerpb.JobState_JOB_STATE_FAILED, err
+	}
+	j.closeWatchers()
+}
+
+func (j *daemonJob) status() *crawlerpb.Job {
+	s := j.crawler.debugStatus()
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	job := &crawlerpb.Job{
+		Id:       j.id,
+		StartUrl: j.crawler.StartURL,
+		State:    j.state,
+		Stage:    s.Stage,
+		Url:      s.URL,
+		Queued:   int64(s.Queued),
+		Crawled:  int64(s.Crawled),
+		Bytes:    j.bytes,
+		Limits:   j.limits,
+	}
+	if j.err != nil {
+		job.Error = j.err.Error()
+	}
+	return job
+}
+
+// gRPC service running up to maxJobs crawls at once, the others
+// wait in the queue in the order they were started
+type daemonServer struct {
+	crawlerpb.UnimplementedCrawlerServer
+	ctx     context.Context
+	maxJobs int
+
+	mu     sync.Mutex
+	jobs   []*daemonJob
+	nextID int
+}
+
+func (d *daemonServer) job(id string) (*daemonJob, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, job := range d.jobs {
+		if job.id == id {
+			return job, nil
+		}
+	}
+	return nil, status.Errorf(codes.NotFound, "no job %s", id)
+}
+
+// Start the queued jobs while there are free slots; d.mu is held
+func (d *daemonServer) schedule() {
+	running := 0
+	var queued []*daemonJob
+	for _, job := range d.jobs {
+		job.mu.Lock()
+		switch job.state {
+		case crawlerpb.JobState_JOB_STATE_RUNNING:
+			running++
+		case crawlerpb.JobState_JOB_STATE_QUEUED:
+			queued = append(queued, job)
+		}
+		job.mu.Unlock()
+	}
+	for _, job := range queued {
+		if running >= d.maxJobs {
+			return
+		}
+		running++
+		job.start(d.ctx, func() {
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			d.schedule()
+		})
+	}
+}
+
+func (d *daemonServer) StartCrawl(_ context.Context, req *crawlerpb.StartCrawlRequest) (*crawlerpb.Job, error) {
+	fs := flag.NewFlagSet("job", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	args := append([]string{"-start", req.StartUrl, "-dir", req.Dir}, req.Args...)
+	c, opts, err := parseCrawlFlags(fs, args)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if c.StartURL == "" || c.DestDir == "" {
+		return nil, status.Error(codes.InvalidArgument, "start_url and dir are required")
+	}
+	// Each job keeps its state with its files
+	stateSet := false
+	fs.Visit(func(f *flag.Flag) { stateSet = stateSet || f.Name == "state" })
+	if !stateSet {
+		c.StateFile = filepath.Join(c.DestDir, "state.json")
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, other := range d.jobs {
+		other.mu.Lock()
+		active := !other.over()
+		other.mu.Unlock()
+		if active && (other.crawler.StateFile == c.StateFile || other.crawler.DestDir == c.DestDir) {
+			return nil, status.Errorf(codes.FailedPrecondition, "job %s is using the same directory or state file", other.id)
+		}
+	}
+	d.nextID++
+	job := &daemonJob{
+		id:       strconv.Itoa(d.nextID),
+		crawler:  c,
+		opts:     opts,
+		limits:   req.Limits,
+		state:    crawlerpb.JobState_JOB_STATE_QUEUED,
+		cancel:   func(error) {},
+		watchers: make(map[chan *crawlerpb.PageEvent]bool),
+	}
+	c.onPage = job.publish
+	d.jobs = append(d.jobs, job)
+	d.schedule()
+	return job.status(), nil
+}
+
+func (d *daemonServer) GetStatus(_ context.Context, req *crawlerpb.GetStatusRequest) (*crawlerpb.Job, error) {
+	job, err := d.job(req.Id)
+	if err != nil {
+		return nil, err
+	}
+	return job.status(), nil
+}
+
+func (d *daemonServer) ListJobs(context.Context, *crawlerpb.ListJobsRequest) (*crawlerpb.ListJobsResponse, error) {
+	d.mu.Lock()
+	jobs := append([]*daemonJob(nil), d.jobs...)
+	d.mu.Unlock()
+	resp := &crawlerpb.ListJobsResponse{}
+	for _, job := range jobs {
+		resp.Jobs = append(resp.Jobs, job.status())
+	}
+	return resp, nil
+}
+
+// A paused job frees its slot for the queued ones
+func (d *daemonServer) Pause(_ context.Context, req *crawlerpb.PauseRequest) (*crawlerpb.Job, error) {
+	job, err := d.job(req.Id)
+	if err != nil {
+		return nil, err
+	}
+	job.mu.Lock()
+	if job.state != crawlerpb.JobState_JOB_STATE_RUNNING {
+		job.mu.Unlock()
+		return nil, status.Errorf(codes.FailedPrecondition, "job %s is not running", job.id)
+	}
+	job.crawler.control.setPaused(true)
+	job.state = crawlerpb.JobState_JOB_STATE_PAUSED
+	job.mu.Unlock()
+
+	d.mu.Lock()
+	d.schedule()
+	d.mu.Unlock()
+	return job.status(), nil
+}
+
+// A resumed job runs right away, even when every slot is taken
+func (d *daemonServer) Resume(_ context.Context, req *crawlerpb.ResumeRequest) (*crawlerpb.Job, error) {
+	job, err := d.job(req.Id)
+	if err != nil {
+		return nil, err
+	}
+	job.mu.Lock()
+	if job.state != crawlerpb.JobState_JOB_STATE_PAUSED {
+		job.mu.Unlock()
+		return nil, status.Errorf(codes.FailedPrecondition, "job %s is not paused", job.id)
+	}
+	job.crawler.control.setPaused(false)
+	job.state = crawlerpb.JobState_JOB_STATE_RUNNING
+	job.mu.Unlock()
+	return job.status(), nil
+}
+
+func (d *daemonServer) Cancel(_ context.Context, req *crawlerpb.CancelRequest) (*crawlerpb.Job, error) {
+	job, err := d.job(req.Id)
+	if err != nil {
+		return nil, err
+	}
+	job.mu.Lock()
+	if job.state == crawlerpb.JobState_JOB_STATE_QUEUED {
+		job.state = crawlerpb.JobState_JOB_STATE_CANCELED
+		job.closeWatchers()
+	}
+	job.cancel(context.Canceled)
+	job.mu.Unlock()
+	return job.status(), nil
+}
+
+func (d *daemonServer) WatchEvents(req *crawlerpb.WatchEventsRequest, stream grpc.ServerStreamingServer[crawlerpb.PageEvent]) error {
+	job, err := d.job(req.Id)
+	if err != nil {
+		return err
+	}
+	events := job.watch()
+	if events == nil {
+		return nil
+	}
+	defer job.unwatch(events)
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
+
+// daemon: serve the gRPC API until interrupted
+func runDaemon(args []string) error {
+	fs := flag.NewFlagSet("daemon", flag.ExitOnError)
+	listen := fs.String("listen", "localhost:50051", "Address of the gRPC server")
+	maxJobs := fs.Int("max-jobs", 2, "Crawls running at the same time, the others are queued")
+	fs.Parse(args)
+	if *maxJobs < 1 {
+		return fmt.Errorf("invalid -max-jobs %d", *maxJobs)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	lis, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return err
+	}
+	server := grpc.NewServer()
+	crawlerpb.RegisterCrawlerServer(server, &daemonServer{ctx: ctx, maxJobs: *maxJobs})
+	go func() {
+		<-ctx.Done()
+		server.GracefulStop()
+	}()
+	fmt.Println("Listening on", lis.Addr())
+	return server.Serve(lis)
+}
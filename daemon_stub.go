@@ -0,0 +1,10 @@
+//go:build !grpc
+
+package main
+
+import "errors"
+
+// The daemon needs gRPC: build with -tags grpc
+func runDaemon(args []string) error {
+	return errors.New("the daemon is not available, build with -tags grpc")
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	_ "net/http/pprof"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// What the crawl loop is doing, read by the debug endpoint
+// from another goroutine
+type progress struct {
+	mu      sync.Mutex
+	stage   string
+	url     string
+	since   time.Time
+	queued  int
+	crawled int
+	hosts   map[string]*hostStats
+
+	frontier frontierStats
+}
+
+// Requests made to a host, files saved and URLs queued
+type hostStats struct {
+	Pages   int           `json:"pages"`
+	Errors  int           `json:"errors"`
+	Saved   int           `json:"saved"`
+	Bytes   int64         `json:"bytes"`
+	Queued  int           `json:"queued"`
+	Latency time.Duration `json:"-"`
+}
+
+func (p *progress) set(stage, url string, queued int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if stage == "processing" {
+		p.crawled++
+	}
+	p.stage, p.url, p.since, p.queued = stage, url, time.Now(), queued
+	p.sample(p.since)
+}
+
+// Counters of the host; p.mu is held
+func (p *progress) host(host string) *hostStats {
+	if p.hosts == nil {
+		p.hosts = make(map[string]*hostStats)
+	}
+	stats, ok := p.hosts[host]
+	if !ok {
+		stats = &hostStats{}
+		p.hosts[host] = stats
+	}
+	return stats
+}
+
+// Count a response (status 0 when the request failed)
+func (p *progress) fetched(host string, status int, latency time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := p.host(host)
+	stats.Pages++
+	if status == 0 || status >= 400 {
+		stats.Errors++
+	}
+	stats.Latency += latency
+}
+
+// Count a file saved
+func (p *progress) saved(host string, size int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := p.host(host)
+	stats.Saved++
+	stats.Bytes += size
+}
+
+// Update the queued URLs of every host
+func (p *progress) setQueued(queued map[string]int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, stats := range p.hosts {
+		stats.Queued = 0
+	}
+	for host, n := range queued {
+		if n > 0 {
+			p.host(host).Queued = n
+		}
+	}
+}
+
+// Copy of the per-host counters
+func (p *progress) hostsSnapshot() map[string]hostStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	hosts := make(map[string]hostStats, len(p.hosts))
+	for host, stats := range p.hosts {
+		hosts[host] = *stats
+	}
+	return hosts
+}
+
+// Snapshot dumped by /debug/crawler
+type debugStatus struct {
+	Stage      string               `json:"stage"`
+	URL        string               `json:"url,omitempty"`
+	StageFor   string               `json:"stage_for"`
+	Queued     int                  `json:"queued"`
+	Crawled    int                  `json:"crawled"`
+	Goroutines int                  `json:"goroutines"`
+	Hosts      map[string]hostStats `json:"hosts"`
+	Frontier   frontierReport       `json:"frontier"`
+	Memory     debugMemStats        `json:"memory"`
+}
+
+type debugMemStats struct {
+	HeapAlloc  uint64 `json:"heap_alloc"`
+	HeapInuse  uint64 `json:"heap_inuse"`
+	Sys        uint64 `json:"sys"`
+	NumGC      uint32 `json:"num_gc"`
+	PauseTotal string `json:"pause_total"`
+}
+
+func (c *Crawler) debugStatus() debugStatus {
+	c.progress.mu.Lock()
+	status := debugStatus{
+		Stage:      c.progress.stage,
+		URL:        c.progress.url,
+		Queued:     c.progress.queued,
+		Crawled:    c.progress.crawled,
+		Goroutines: runtime.NumGoroutine(),
+	}
+	if !c.progress.since.IsZero() {
+		status.StageFor = time.Since(c.progress.since).Round(time.Millisecond).String()
+	}
+	c.progress.mu.Unlock()
+	status.Hosts = c.progress.hostsSnapshot()
+	status.Frontier = c.progress.frontierReport()
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	status.Memory = debugMemStats{
+		HeapAlloc:  mem.HeapAlloc,
+		HeapInuse:  mem.HeapInuse,
+		Sys:        mem.Sys,
+		NumGC:      mem.NumGC,
+		PauseTotal: time.Duration(mem.PauseTotalNs).String(),
+	}
+	return status
+}
+
+// Serve net/http/pprof and /debug/crawler on addr, in background
+func (c *Crawler) serveDebug(addr string) {
+	http.HandleFunc("/debug/crawler", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(c.debugStatus())
+	})
+	go func() {
+		if err := http.ListenAndServe(addr, nil); err != nil {
+			fmt.Println("Error serving pprof:", err)
+		}
+	}()
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// How often the free space is checked while the crawl is paused
+const diskPollInterval = 30 * time.Second
+
+// Size of the files recorded in the state
+func savedSize(state State) int64 {
+	var total int64
+	for _, rec := range state {
+		if rec.SavePath != "" {
+			total += rec.Size
+		}
+	}
+	return total
+}
+
+var errTotalSize = errors.New("total size limit reached")
+
+func (c *Crawler) totalSizeReached() error {
+	return fmt.Errorf("%w: %d bytes", errTotalSize, c.MaxTotalSize)
+}
+
+// Reader failing when more than left bytes are read, for bodies
+// whose size is not known in advance
+type quotaReader struct {
+	r    io.Reader
+	left int64
+	err  error
+}
+
+func (q *quotaReader) Read(p []byte) (int, error) {
+	if q.left <= 0 {
+		// At the limit: fail only if the body goes on
+		var probe [1]byte
+		n, err := q.r.Read(probe[:])
+		if n > 0 {
+			return 0, q.err
+		}
+		return 0, err
+	}
+	if int64(len(p)) > q.left {
+		p = p[:q.left]
+	}
+	n, err := q.r.Read(p)
+	q.left -= int64(n)
+	return n, err
+}
+
+// Make room for n more bytes before writing them. Past MaxTotalSize
+// the crawl stops; while the free space is below MinFreeSpace it is
+// paused. Either way nothing is half written and the page is left in
+// the frontier saved when the crawl stops, so it can be resumed.
+func (c *Crawler) reserveSpace(ctx context.Context, n int64) error {
+	if c.MaxTotalSize > 0 && c.savedBytes+n > c.MaxTotalSize {
+		return c.totalSizeReached()
+	}
+	if c.MinFreeSpace <= 0 {
+		return nil
+	}
+	paused := false
+	for {
+		free, err := freeSpace(c.DestDir)
+		if err != nil || free-n >= c.MinFreeSpace {
+			if paused {
+				fmt.Println("Disk space available again, crawl resumed")
+			}
+			return nil
+		}
+		if !paused {
+			fmt.Printf("Only %d bytes free in %s, crawl paused until space is freed\n", free, c.DestDir)
+			c.progress.set("paused", "", c.queue.Len())
+			paused = true
+		}
+		select {
+		case <-time.After(diskPollInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
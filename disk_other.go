@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "errors"
+
+// The free space is not checked on this platform
+func freeSpace(dir string) (int64, error) {
+	return 0, errors.New("free space not available")
+}
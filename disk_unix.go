@@ -0,0 +1,18 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// Bytes available to the user on the volume of dir
+func freeSpace(dir string) (int64, error) {
+	os.MkdirAll(dir, os.ModePerm)
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(dir, &fs); err != nil {
+		return 0, err
+	}
+	return int64(fs.Bavail) * int64(fs.Bsize), nil
+}
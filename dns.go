@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+type dnsEntry struct {
+	ips     []string
+	expires time.Time
+}
+
+// Resolver with an in-process cache, an optional custom DNS server,
+// IPv4/IPv6 preference and static host to IP mappings
+type dnsResolver struct {
+	resolver *net.Resolver
+	dialer   *net.Dialer
+	ttl      time.Duration
+	prefer   string
+	static   map[string]string
+
+	mu    sync.Mutex
+	cache map[string]dnsEntry
+}
+
+func newDNSResolver(server string, ttl time.Duration, prefer string, static map[string]string) *dnsResolver {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	resolver := net.DefaultResolver
+	if server != "" {
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, server)
+			},
+		}
+	}
+	return &dnsResolver{
+		resolver: resolver,
+		dialer:   dialer,
+		ttl:      ttl,
+		prefer:   prefer,
+		static:   static,
+		cache:    make(map[string]dnsEntry),
+	}
+}
+
+func (r *dnsResolver) lookup(ctx context.Context, host string) ([]string, error) {
+	if ip, ok := r.static[host]; ok {
+		return []string{ip}, nil
+	}
+	if net.ParseIP(host) != nil {
+		return []string{host}, nil
+	}
+
+	r.mu.Lock()
+	entry, ok := r.cache[host]
+	r.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.ips, nil
+	}
+
+	ips, err := r.resolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	r.sortIPs(ips)
+	if r.ttl > 0 {
+		r.mu.Lock()
+		r.cache[host] = dnsEntry{ips: ips, expires: time.Now().Add(r.ttl)}
+		r.mu.Unlock()
+	}
+	return ips, nil
+}
+
+// Put the preferred IP version first
+func (r *dnsResolver) sortIPs(ips []string) {
+	if r.prefer != "ipv4" && r.prefer != "ipv6" {
+		return
+	}
+	preferV4 := r.prefer == "ipv4"
+	sort.SliceStable(ips, func(i, j int) bool {
+		iv4 := net.ParseIP(ips[i]).To4() != nil
+		jv4 := net.ParseIP(ips[j]).To4() != nil
+		if preferV4 {
+			return iv4 && !jv4
+		}
+		return !iv4 && jv4
+	})
+}
+
+// Dial the resolved addresses in order until one succeeds
+func (r *dnsResolver) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := r.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	var lastErr error
+	for _, ip := range ips {
+		conn, err := r.dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no addresses for %s", host)
+	}
+	return nil, lastErr
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// The parsed page is saved, rather than the bytes received
+func (c *Crawler) renderPages() bool {
+	return c.Save == "dom" || len(c.Transforms) > 0
+}
+
+// Serialize the parsed page for -save dom and the Transforms. The
+// tree is decoded to UTF-8 and its charset declaration updated; with
+// ConvertLinks the links to the URLs queued or saved point to the
+// local copies, the others are made absolute. The tree is left
+// unchanged.
+func (c *Crawler) renderDOM(doc *html.Node, u *url.URL) ([]byte, error) {
+	savePath := c.localPath(u)
+	var edits domEdits
+	defer edits.undo()
+	c.transformDOM(doc, &edits)
+	set := edits.setAttr
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			for i := range n.Attr {
+				attr := &n.Attr[i]
+				switch {
+				case n.Data == "meta" && attr.Key == "charset":
+					set(attr, "utf-8")
+				case n.Data == "meta" && attr.Key == "content" && strings.EqualFold(getAttr(n, "http-equiv"), "content-type"):
+					set(attr, "text/html; charset=utf-8")
+				case c.ConvertLinks && c.convertible(n, attr.Key):
+					if local, ok := c.localLink(attr.Val, u, savePath); ok {
+						set(attr, local)
+					}
+				}
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(doc)
+
+	var buf bytes.Buffer
+	err := html.Render(&buf, doc)
+	return buf.Bytes(), err
+}
+
+// Links followed by the crawler, and asset references when
+// assets are downloaded
+func (c *Crawler) convertible(n *html.Node, key string) bool {
+	if linkAttrs[n.Data] == key {
+		return true
+	}
+	if !c.Assets {
+		return false
+	}
+	if n.Data == "link" {
+		if key != "href" {
+			return false
+		}
+		for _, rel := range strings.Fields(strings.ToLower(getAttr(n, "rel"))) {
+			if assetRels[rel] {
+				return true
+			}
+		}
+		return false
+	}
+	for _, attr := range assetAttrs[n.Data] {
+		if attr == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Path of the local copy of link relative to the page saved in savePath,
+// or like wget the absolute URL when it was not crawled
+func (c *Crawler) localLink(link string, base *url.URL, savePath string) (string, bool) {
+	link = strings.TrimSpace(link)
+	if link == "" || strings.HasPrefix(link, "#") {
+		return "", false
+	}
+	ref, err := url.Parse(link)
+	if err != nil {
+		return "", false
+	}
+	target := base.ResolveReference(ref)
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return "", false
+	}
+	absolute := target.String()
+	if !c.inScope(target) {
+		return absolute, true
+	}
+	fragment := target.Fragment
+	target.Fragment = ""
+	c.normalize(target)
+	if key := target.String(); !c.queued.Has(key) && !c.visited.Has(key) {
+		return absolute, true
+	}
+	rel, err := filepath.Rel(filepath.Dir(savePath), c.localPath(target))
+	if err != nil {
+		return absolute, true
+	}
+	local := escapeLocalPath(rel)
+	if fragment != "" {
+		local += "#" + fragment
+	}
+	return local, true
+}
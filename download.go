@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Validators of a partial download, saved next to the .part file so
+// the transfer can be resumed with a Range request
+type partialDownload struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// Assets other than stylesheets are streamed to disk and can be resumed
+func (c *Crawler) resumable(item queueItem, resp *http.Response) bool {
+	return item.Asset && c.Store != "cas" && !c.HeadersOnly && !isStylesheet(resp, resp.Request.URL)
+}
+
+// Partial file of a download, under the URL first requested: a
+// redirected download is resumed from the same file
+func (c *Crawler) partPath(req *http.Request) string {
+	return c.localPath(req.URL) + ".part"
+}
+
+// Ask only for the missing bytes when a partial file exists
+func (c *Crawler) addRangeHeaders(req *http.Request) {
+	part := c.partPath(req)
+	info, err := os.Stat(part)
+	if err != nil || info.Size() == 0 {
+		return
+	}
+	data, err := os.ReadFile(part + ".json")
+	if err != nil {
+		return
+	}
+	var partial partialDownload
+	if err := json.Unmarshal(data, &partial); err != nil {
+		return
+	}
+	// If-Range needs a strong validator
+	validator := partial.LastModified
+	if partial.ETag != "" && !strings.HasPrefix(partial.ETag, "W/") {
+		validator = partial.ETag
+	}
+	if validator == "" {
+		return
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", info.Size()))
+	req.Header.Set("If-Range", validator)
+}
+
+// Start of a "bytes start-end/size" Content-Range
+func contentRangeStart(value string) (int64, bool) {
+	value, ok := strings.CutPrefix(value, "bytes ")
+	if !ok {
+		return 0, false
+	}
+	start, _, ok := strings.Cut(value, "-")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(start, 10, 64)
+	return n, err == nil
+}
+
+// Complete size of a "bytes start-end/size" or "bytes */size"
+// Content-Range
+func contentRangeSize(value string) (int64, bool) {
+	_, size, ok := strings.Cut(value, "/")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(size, 10, 64)
+	return n, err == nil
+}
+
+// Hash of a file
+func fileHash(name string) (string, int64, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, file)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// Stream the asset into a .part file, appending to it on a 206 answer,
+// and move it in place when complete. An interrupted transfer is
+// re-queued and resumed from where it stopped.
+func (c *Crawler) saveDownload(crawlCtx context.Context, item queueItem, resp *http.Response) error {
+	defer resp.Body.Close()
+
+	redirects := redirectChain(resp)
+	u := resp.Request.URL
+	urlStr := u.String()
+	if err := c.markAliases(redirects, urlStr, item.Depth); err != nil {
+		return err
+	}
+	c.noteHTTPS(resp, redirects)
+	rec := PageRecord{
+		Status:    resp.StatusCode,
+		FetchedAt: time.Now(),
+		Depth:     item.Depth,
+		Referrer:  item.Referrer,
+	}
+	if urlStr != item.URL && c.visited.Has(urlStr) {
+		return nil
+	}
+
+	// A file crawled again is replaced when the download completes
+	savePath := c.localPath(u)
+	part := c.partPath(firstRequest(resp))
+	os.MkdirAll(filepath.Dir(savePath), os.ModePerm)
+	os.MkdirAll(filepath.Dir(part), os.ModePerm)
+
+	// Only 200 and 206 bring the content, the .part is kept otherwise
+	switch {
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		info, err := os.Stat(part)
+		size, ok := contentRangeSize(resp.Header.Get("Content-Range"))
+		if err == nil && ok && info.Size() == size {
+			// The .part was already complete
+			hash, size, err := fileHash(part)
+			if err != nil {
+				return err
+			}
+			rec.Status = http.StatusOK
+			return c.finishDownload(item, resp, rec, part, savePath, hash, size, 0)
+		}
+		return c.retryDownload(item, fmt.Sprintf("status %d", resp.StatusCode))
+	case resp.StatusCode >= 500:
+		return c.retryDownload(item, fmt.Sprintf("status %d", resp.StatusCode))
+	case resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent:
+		fmt.Printf("Not saving %s, status %d\n", urlStr, resp.StatusCode)
+		c.skipped(urlStr, fmt.Sprintf("status %d", resp.StatusCode))
+		return c.markVisited(urlStr, rec)
+	}
+
+	// The bytes already downloaded are hashed as they are read
+	h := sha256.New()
+	var existing int64
+	if resp.StatusCode == http.StatusPartialContent {
+		file, err := os.Open(part)
+		if err == nil {
+			existing, err = io.Copy(h, file)
+			file.Close()
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if c.MaxFileSize > 0 && resp.ContentLength > 0 && existing+resp.ContentLength > c.MaxFileSize {
+		return c.skipTooLarge(urlStr, part, rec)
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if resp.StatusCode == http.StatusPartialContent {
+		start, ok := contentRangeStart(resp.Header.Get("Content-Range"))
+		if !ok || start != existing {
+			// The server didn't send what was missing: start over
+			os.Remove(part)
+			os.Remove(part + ".json")
+			return c.retryDownload(item, "unexpected range")
+		}
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	} else {
+		partial := partialDownload{
+			URL:          urlStr,
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+		}
+		data, _ := json.Marshal(partial)
+		if err := os.WriteFile(part+".json", data, 0644); pathConflict(err) {
+			c.skipConflict(urlStr, err)
+			return c.markVisited(urlStr, rec)
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if err := c.reserveSpace(crawlCtx, max(resp.ContentLength, 0)); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(part, flags, 0644)
+	if pathConflict(err) {
+		c.skipConflict(urlStr, err)
+		return c.markVisited(urlStr, rec)
+	}
+	if err != nil {
+		return err
+	}
+	var body io.Reader = resp.Body
+	if c.MaxTotalSize > 0 {
+		// The length may be unknown, e.g. a chunked body
+		body = &quotaReader{r: body, left: c.MaxTotalSize - c.savedBytes, err: c.totalSizeReached()}
+	}
+	if c.MaxFileSize > 0 {
+		// One byte more than allowed tells the file is too large
+		body = io.LimitReader(body, c.MaxFileSize-existing+1)
+	}
+	n, err := io.Copy(io.MultiWriter(file, h), body)
+	file.Close()
+	if err == nil && c.MaxFileSize > 0 && existing+n > c.MaxFileSize {
+		return c.skipTooLarge(urlStr, part, rec)
+	}
+	if errors.Is(err, errTotalSize) {
+		// The .part is kept, to resume with a larger limit
+		return err
+	}
+	if err != nil {
+		if crawlCtx.Err() != nil {
+			return crawlCtx.Err()
+		}
+		return c.retryDownload(item, err.Error())
+	}
+	return c.finishDownload(item, resp, rec, part, savePath, hex.EncodeToString(h.Sum(nil)), existing+n, n)
+}
+
+// Move the complete .part in place and record it; added is what this
+// response wrote
+func (c *Crawler) finishDownload(item queueItem, resp *http.Response, rec PageRecord, part, savePath, hash string, size, added int64) error {
+	u := resp.Request.URL
+	urlStr := u.String()
+	if err := os.Rename(part, savePath); pathConflict(err) {
+		os.Remove(part)
+		os.Remove(part + ".json")
+		c.skipConflict(urlStr, err)
+		return c.markVisited(urlStr, rec)
+	} else if err != nil {
+		return err
+	}
+	os.Remove(part + ".json")
+	fmt.Print(savePath)
+	if err := c.recordLongPath(u); err != nil {
+		return err
+	}
+
+	rec.Hash = hash
+	rec.Size = size
+	rec.SavePath = savePath
+	c.savedBytes += added
+	if err := c.recordSum(savePath, rec.Hash); err != nil {
+		return err
+	}
+	err := c.writeMeta(PageMeta{
+		URL:       urlStr,
+		Referrer:  item.Referrer,
+		Status:    rec.Status,
+		Protocol:  resp.Proto,
+		SavePath:  savePath,
+		FetchedAt: time.Now(),
+		Redirects: redirectChain(resp),
+		Wayback:   resp.Header.Get(waybackHeader),
+	})
+	if err != nil {
+		return err
+	}
+	if err := c.markVisited(urlStr, rec); err != nil {
+		return err
+	}
+	return c.writeResult(urlStr, rec, nil, nil)
+}
+
+func (c *Crawler) skipTooLarge(urlStr string, part string, rec PageRecord) error {
+	fmt.Printf("Skip %s, larger than %d bytes\n", urlStr, c.MaxFileSize)
+	c.skipped(urlStr, "too large")
+	os.Remove(part)
+	os.Remove(part + ".json")
+	return c.markVisited(urlStr, rec)
+}
+
+func (c *Crawler) retryDownload(item queueItem, reason string) error {
+	if item.Attempts >= c.MaxRetries {
+		fmt.Printf("Giving up on %s after %d retries: %s\n", item.URL, item.Attempts, reason)
+		c.skipped(item.URL, reason)
+		return nil
+	}
+	fmt.Printf("Download of %s interrupted (%s), it will be resumed\n", item.URL, reason)
+	item.Attempts++
+	c.queue.Push(item)
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// With -link-graph every link is appended to this file in the
+// destination directory, one edge per line
+const edgesFileName = "links.jsonl"
+
+// Edge of the link graph
+type LinkEdge struct {
+	Source  string `json:"source"`
+	Target  string `json:"target"`
+	Tag     string `json:"tag"`
+	Text    string `json:"text,omitempty"`
+	Rel     string `json:"rel,omitempty"`
+	Heading string `json:"heading,omitempty"`
+}
+
+func (c *Crawler) writeEdges(doc *html.Node, u *url.URL) error {
+	if c.edgesFile == nil {
+		os.MkdirAll(c.DestDir, os.ModePerm)
+		file, err := os.OpenFile(filepath.Join(c.DestDir, edgesFileName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		c.edgesFile = file
+	}
+	encoder := json.NewEncoder(c.edgesFile)
+	for _, link := range extractPageLinks(doc) {
+		href, _, _ := strings.Cut(strings.TrimSpace(link.Href), "#")
+		if href == "" {
+			continue
+		}
+		ref, err := url.Parse(href)
+		if err != nil || skippedSchemes[strings.ToLower(ref.Scheme)] {
+			continue
+		}
+		err = encoder.Encode(LinkEdge{
+			Source:  u.String(),
+			Target:  u.ResolveReference(ref).String(),
+			Tag:     link.Tag,
+			Text:    link.Text,
+			Rel:     link.Rel,
+			Heading: link.Heading,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
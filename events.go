@@ -0,0 +1,91 @@
+package main
+
+import "time"
+
+// EventHandler receives what happens during the crawl, e.g. to show
+// the progress in a GUI. The methods are called from the crawl loop
+// and should return quickly.
+type EventHandler interface {
+	// A response was received
+	OnFetch(FetchEvent)
+	// A file was saved
+	OnSave(SaveEvent)
+	// A request failed, or the crawl stopped because of an error
+	OnError(ErrorEvent)
+	// A URL was not crawled or not saved
+	OnSkip(SkipEvent)
+}
+
+type FetchEvent struct {
+	URL      string
+	Status   int
+	Protocol string
+	Latency  time.Duration
+	// Previous attempts of the URL
+	Attempt int
+	Depth   int
+}
+
+type SaveEvent struct {
+	URL   string
+	Path  string
+	Size  int64
+	Hash  string
+	Depth int
+}
+
+type ErrorEvent struct {
+	URL string
+	Err error
+	// The crawl stopped
+	Fatal bool
+}
+
+type SkipEvent struct {
+	URL    string
+	Reason string
+}
+
+// EventFuncs is an EventHandler calling the functions that are set
+type EventFuncs struct {
+	Fetch func(FetchEvent)
+	Save  func(SaveEvent)
+	Error func(ErrorEvent)
+	Skip  func(SkipEvent)
+}
+
+func (f EventFuncs) OnFetch(e FetchEvent) {
+	if f.Fetch != nil {
+		f.Fetch(e)
+	}
+}
+
+func (f EventFuncs) OnSave(e SaveEvent) {
+	if f.Save != nil {
+		f.Save(e)
+	}
+}
+
+func (f EventFuncs) OnError(e ErrorEvent) {
+	if f.Error != nil {
+		f.Error(e)
+	}
+}
+
+func (f EventFuncs) OnSkip(e SkipEvent) {
+	if f.Skip != nil {
+		f.Skip(e)
+	}
+}
+
+// Handler of the events, doing nothing if Events is nil
+func (c *Crawler) events() EventHandler {
+	if c.Events == nil {
+		return EventFuncs{}
+	}
+	return c.Events
+}
+
+func (c *Crawler) skipped(url, reason string) {
+	c.events().OnSkip(SkipEvent{URL: url, Reason: reason})
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Attribute holding the link for each element followed by the crawler
+var linkAttrs = map[string]string{
+	"a":      "href",
+	"iframe": "src",
+	"frame":  "src",
+}
+
+// Link of a page with its context: anchor text, rel attribute and
+// the text of the closest heading before it
+type PageLink struct {
+	Href    string
+	Tag     string
+	Text    string
+	Rel     string
+	Heading string
+}
+
+// Find the links of the page, including frames and the content
+// of <noscript> blocks
+func extractLinks(doc *html.Node) []string {
+	var links []string
+	for _, link := range extractPageLinks(doc) {
+		links = append(links, link.Href)
+	}
+	return links
+}
+
+func extractPageLinks(doc *html.Node) []PageLink {
+	var links []PageLink
+	heading := ""
+	var findLinks func(*html.Node)
+	findLinks = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "h1", "h2", "h3", "h4", "h5", "h6":
+				heading = nodeText(n)
+			}
+			if key, ok := linkAttrs[n.Data]; ok {
+				for _, attr := range n.Attr {
+					if attr.Key == key {
+						links = append(links, PageLink{
+							Href:    attr.Val,
+							Tag:     n.Data,
+							Text:    anchorText(n),
+							Rel:     getAttr(n, "rel"),
+							Heading: heading,
+						})
+					}
+				}
+			}
+			// The parser keeps the content of <noscript> as text
+			if n.Data == "noscript" {
+				for c := n.FirstChild; c != nil; c = c.NextSibling {
+					if c.Type != html.TextNode {
+						continue
+					}
+					if inner, err := html.Parse(strings.NewReader(c.Data)); err == nil {
+						findLinks(inner)
+					}
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			findLinks(c)
+		}
+	}
+	findLinks(doc)
+	return links
+}
+
+// Navigation in event handlers and javascript: links, like
+// location.href='...', location.assign('...') or window.open('...')
+var scriptNavigation = regexp.MustCompile(`(?:\blocation(?:\.href)?\s*=|\blocation\.(?:assign|replace)\s*\(|\bwindow\.open\s*\()\s*(?:'([^']*)'|"([^"]*)")`)
+
+// Find the URLs opened by the inline scripts of the elements, for
+// the sites without real anchors
+func heuristicLinks(doc *html.Node) []string {
+	var links []string
+	var find func(*html.Node)
+	find = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			for _, attr := range n.Attr {
+				key := strings.ToLower(attr.Key)
+				if !strings.HasPrefix(key, "on") && !strings.HasPrefix(strings.ToLower(strings.TrimSpace(attr.Val)), "javascript:") {
+					continue
+				}
+				for _, m := range scriptNavigation.FindAllStringSubmatch(attr.Val, -1) {
+					links = append(links, m[1]+m[2])
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			find(c)
+		}
+	}
+	find(doc)
+	return links
+}
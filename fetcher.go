@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Fetcher gets the URLs of a scheme other than http and https,
+// answering like an HTTP server would
+type Fetcher interface {
+	Fetch(req *http.Request) (*http.Response, error)
+}
+
+// Fetchers used when the Crawler sets none; local files are only
+// read when the crawl starts from one
+func defaultFetchers(startURL string) map[string]Fetcher {
+	fetchers := map[string]Fetcher{"ftp": ftpFetcher{}}
+	if u, err := url.Parse(startURL); err == nil && u.Scheme == "file" {
+		fetchers["file"] = fileFetcher{}
+	}
+	return fetchers
+}
+
+// Send the requests to the fetcher of their scheme, if any
+type schemeTransport struct {
+	fetchers map[string]Fetcher
+	next     http.RoundTripper
+}
+
+func (t *schemeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if fetcher, ok := t.fetchers[req.URL.Scheme]; ok {
+		return fetcher.Fetch(req)
+	}
+	return t.next.RoundTrip(req)
+}
+
+// The URL can be crawled: HTTP or a scheme with a fetcher. Local
+// files are only linked from local files.
+func (c *Crawler) fetchable(u, page *url.URL) bool {
+	if u.Scheme == "file" && page.Scheme != "file" {
+		return false
+	}
+	if u.Scheme == "http" || u.Scheme == "https" {
+		return true
+	}
+	_, ok := c.Fetchers[u.Scheme]
+	return ok
+}
+
+func fetchResponse(req *http.Request, status int, body io.ReadCloser, size int64, name string) *http.Response {
+	resp := &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         strings.ToUpper(req.URL.Scheme),
+		Header:        make(http.Header),
+		Body:          body,
+		ContentLength: size,
+		Request:       req,
+	}
+	if contentType := mime.TypeByExtension(path.Ext(name)); contentType != "" {
+		resp.Header.Set("Content-Type", contentType)
+	}
+	if size >= 0 {
+		resp.Header.Set("Content-Length", strconv.FormatInt(size, 10))
+	}
+	return resp
+}
+
+func notFound(req *http.Request) *http.Response {
+	return fetchResponse(req, http.StatusNotFound, http.NoBody, 0, "")
+}
+
+// Local files, e.g. a page listing the URLs to start from
+type fileFetcher struct{}
+
+func (fileFetcher) Fetch(req *http.Request) (*http.Response, error) {
+	name := req.URL.Path
+	file, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return notFound(req), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		file.Close()
+		return notFound(req), err
+	}
+	return fetchResponse(req, http.StatusOK, file, info.Size(), name), nil
+}
+
+// Files on FTP servers, downloaded in passive mode, anonymously
+// unless the URL has a user
+type ftpFetcher struct{}
+
+func (ftpFetcher) Fetch(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	if req.URL.Port() == "" {
+		host = net.JoinHostPort(req.URL.Hostname(), "21")
+	}
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	conn, err := dialer.DialContext(req.Context(), "tcp", host)
+	if err != nil {
+		return nil, err
+	}
+	ctrl := textproto.NewConn(conn)
+	fail := func(err error) (*http.Response, error) {
+		ctrl.Close()
+		return nil, err
+	}
+	if _, _, err := ctrl.ReadResponse(220); err != nil {
+		return fail(err)
+	}
+
+	user, pass := "anonymous", "anonymous@"
+	if req.URL.User != nil {
+		user = req.URL.User.Username()
+		pass, _ = req.URL.User.Password()
+	}
+	code, msg, err := ftpCmd(ctrl, "USER %s", user)
+	if err == nil && code == 331 {
+		code, msg, err = ftpCmd(ctrl, "PASS %s", pass)
+	}
+	if err != nil {
+		return fail(err)
+	}
+	if code != 230 {
+		return fail(fmt.Errorf("ftp login failed: %d %s", code, msg))
+	}
+	if code, msg, err = ftpCmd(ctrl, "TYPE I"); err != nil || code != 200 {
+		return fail(fmt.Errorf("ftp TYPE I failed: %d %s %v", code, msg, err))
+	}
+
+	size := int64(-1)
+	if code, msg, err = ftpCmd(ctrl, "SIZE %s", req.URL.Path); err == nil && code == 213 {
+		size, _ = strconv.ParseInt(strings.TrimSpace(msg), 10, 64)
+	}
+	dataAddr, err := ftpPassive(ctrl, req.URL.Hostname())
+	if err != nil {
+		return fail(err)
+	}
+	data, err := dialer.DialContext(req.Context(), "tcp", dataAddr)
+	if err != nil {
+		return fail(err)
+	}
+	code, msg, err = ftpCmd(ctrl, "RETR %s", req.URL.Path)
+	if err != nil {
+		data.Close()
+		return fail(err)
+	}
+	if code == 550 {
+		data.Close()
+		ctrl.Close()
+		return notFound(req), nil
+	}
+	if code != 125 && code != 150 {
+		data.Close()
+		return fail(fmt.Errorf("ftp RETR failed: %d %s", code, msg))
+	}
+	body := &ftpBody{Reader: bufio.NewReader(data), data: data, ctrl: ctrl}
+	return fetchResponse(req, http.StatusOK, body, size, req.URL.Path), nil
+}
+
+func ftpCmd(ctrl *textproto.Conn, format string, args ...any) (int, string, error) {
+	if _, err := ctrl.Cmd(format, args...); err != nil {
+		return 0, "", err
+	}
+	code, msg, err := ctrl.ReadResponse(0)
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		err = nil
+	}
+	return code, msg, err
+}
+
+// Address of the data connection, from EPSV or PASV
+func ftpPassive(ctrl *textproto.Conn, host string) (string, error) {
+	if code, msg, err := ftpCmd(ctrl, "EPSV"); err == nil && code == 229 {
+		// 229 Entering Extended Passive Mode (|||port|)
+		start, end := strings.Index(msg, "(|||"), strings.LastIndex(msg, "|)")
+		if start >= 0 && end > start+4 {
+			return net.JoinHostPort(host, msg[start+4:end]), nil
+		}
+	}
+	code, msg, err := ftpCmd(ctrl, "PASV")
+	if err != nil {
+		return "", err
+	}
+	// 227 Entering Passive Mode (h1,h2,h3,h4,p1,p2)
+	start, end := strings.Index(msg, "("), strings.Index(msg, ")")
+	if code != 227 || start < 0 || end < start {
+		return "", fmt.Errorf("ftp PASV failed: %d %s", code, msg)
+	}
+	parts := strings.Split(msg[start+1:end], ",")
+	if len(parts) != 6 {
+		return "", fmt.Errorf("invalid PASV reply %s", msg)
+	}
+	p1, err1 := strconv.Atoi(parts[4])
+	p2, err2 := strconv.Atoi(parts[5])
+	if err1 != nil || err2 != nil {
+		return "", fmt.Errorf("invalid PASV reply %s", msg)
+	}
+	return net.JoinHostPort(host, strconv.Itoa(p1*256+p2)), nil
+}
+
+// Body of an FTP download: closing it ends the session
+type ftpBody struct {
+	io.Reader
+	data net.Conn
+	ctrl *textproto.Conn
+}
+
+func (b *ftpBody) Close() error {
+	b.data.Close()
+	b.ctrl.ReadResponse(226)
+	b.ctrl.Cmd("QUIT")
+	return b.ctrl.Close()
+}
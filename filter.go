@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Schemes that can't be crawled
+var skippedSchemes = map[string]bool{
+	"javascript": true,
+	"mailto":     true,
+	"tel":        true,
+	"data":       true,
+}
+
+// Counts of the links filtered before reaching the queue
+type FilterStats struct {
+	Empty     int
+	Fragments int
+	Schemes   map[string]int
+}
+
+// Drop empty hrefs and non-crawlable schemes, strip fragments.
+// It returns false if the link must be skipped. A link is counted
+// once, a fragment-only one as empty.
+func (c *Crawler) filterLink(link string) (string, bool) {
+	link = strings.TrimSpace(link)
+	fragment := false
+	if i := strings.Index(link, "#"); i >= 0 {
+		link = link[:i]
+		fragment = true
+	}
+	if link == "" {
+		c.Filtered.Empty++
+		return "", false
+	}
+	if scheme, _, ok := strings.Cut(link, ":"); ok {
+		scheme = strings.ToLower(scheme)
+		if skippedSchemes[scheme] {
+			if c.Filtered.Schemes == nil {
+				c.Filtered.Schemes = make(map[string]int)
+			}
+			c.Filtered.Schemes[scheme]++
+			return "", false
+		}
+	}
+	if fragment {
+		c.Filtered.Fragments++
+	}
+	return link, true
+}
+
+func (s FilterStats) Print() {
+	fmt.Println("Filtered links:")
+	fmt.Printf("  empty: %d\n", s.Empty)
+	fmt.Printf("  fragments stripped: %d\n", s.Fragments)
+	schemes := make([]string, 0, len(s.Schemes))
+	for scheme := range s.Schemes {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	for _, scheme := range schemes {
+		fmt.Printf("  %s: %d\n", scheme, s.Schemes[scheme])
+	}
+}
+
+// Tell if the page body can be saved and its links followed
+// according to the content regexps
+func (c *Crawler) contentAllowed(body []byte) (save bool, follow bool) {
+	matches := (c.MatchContent == nil || c.MatchContent.Match(body)) &&
+		(c.ExcludeContent == nil || !c.ExcludeContent.Match(body))
+	if matches {
+		return true, true
+	}
+	switch c.ContentFilter {
+	case "follow":
+		return true, false
+	case "both":
+		return false, false
+	default:
+		return false, true
+	}
+}
+
+// Parse a comma separated list of glob patterns
+func parseGlobs(value string) ([]string, error) {
+	var globs []string
+	for _, g := range strings.Split(value, ",") {
+		if g = strings.TrimSpace(g); g == "" {
+			continue
+		}
+		if _, err := path.Match(g, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %v", g, err)
+		}
+		globs = append(globs, g)
+	}
+	return globs, nil
+}
+
+// Like wget, patterns match the file name; patterns with a "/"
+// match the whole path
+func matchGlobs(globs []string, u *url.URL) bool {
+	name := path.Base(u.Path)
+	for _, g := range globs {
+		target := name
+		if strings.Contains(g, "/") {
+			target = u.Path
+		}
+		if ok, _ := path.Match(g, target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Crawler) rejected(u *url.URL) bool {
+	return matchGlobs(c.Reject, u)
+}
+
+// With -accept only matching files are saved: other pages are still
+// fetched to follow their links, other assets are not fetched at all
+func (c *Crawler) accepted(u *url.URL) bool {
+	return len(c.Accept) == 0 || matchGlobs(c.Accept, u)
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"cmp"
+	"container/heap"
+	"net/url"
+	"slices"
+	"time"
+)
+
+// URL waiting to be crawled
+type queueItem struct {
+	URL      string `json:"url"`
+	Referrer string `json:"referrer,omitempty"`
+	// Number of times the URL has been re-queued
+	Attempts int `json:"attempts,omitempty"`
+	// Saved as it is, without looking for links
+	Asset bool `json:"asset,omitempty"`
+	// Links followed from the start URL
+	Depth int `json:"depth"`
+	// Pagination links followed to reach the URL, which is
+	// crawled before the others when it is a pagination link
+	Pagination int  `json:"pagination,omitempty"`
+	Priority   bool `json:"priority,omitempty"`
+}
+
+// Queue of the URLs to crawl, by host. The hosts that can be requested
+// now are ordered by their first URL, priority ones first, the others
+// by the time they can be requested.
+type frontier struct {
+	hosts   map[string]*hostQueue
+	ready   hostHeap
+	waiting hostHeap
+	len     int
+	// Order of the URLs pushed
+	seq uint64
+}
+
+type frontierItem struct {
+	item queueItem
+	seq  uint64
+}
+
+// URLs queued for a host, the priority ones apart
+type hostQueue struct {
+	host     string
+	priority []frontierItem
+	normal   []frontierItem
+	// Time the host can be requested, as last seen by Pop
+	readyAt time.Time
+	// Heap the host is in and its position there
+	heap  *hostHeap
+	index int
+}
+
+func (q *hostQueue) len() int {
+	return len(q.priority) + len(q.normal)
+}
+
+func (q *hostQueue) head() frontierItem {
+	if len(q.priority) > 0 {
+		return q.priority[0]
+	}
+	return q.normal[0]
+}
+
+func (q *hostQueue) pop() queueItem {
+	if len(q.priority) > 0 {
+		item := q.priority[0].item
+		q.priority[0] = frontierItem{}
+		q.priority = q.priority[1:]
+		return item
+	}
+	item := q.normal[0].item
+	q.normal[0] = frontierItem{}
+	q.normal = q.normal[1:]
+	return item
+}
+
+// Order of the first URLs of two hosts
+func headBefore(a, b *hostQueue) bool {
+	ha, hb := a.head(), b.head()
+	if ha.item.Priority != hb.item.Priority {
+		return ha.item.Priority
+	}
+	return ha.seq < hb.seq
+}
+
+func readyBefore(a, b *hostQueue) bool {
+	if !a.readyAt.Equal(b.readyAt) {
+		return a.readyAt.Before(b.readyAt)
+	}
+	return headBefore(a, b)
+}
+
+// Heap of hosts, for container/heap
+type hostHeap struct {
+	hosts []*hostQueue
+	less  func(a, b *hostQueue) bool
+}
+
+func (h *hostHeap) Len() int           { return len(h.hosts) }
+func (h *hostHeap) Less(i, j int) bool { return h.less(h.hosts[i], h.hosts[j]) }
+
+func (h *hostHeap) Swap(i, j int) {
+	h.hosts[i], h.hosts[j] = h.hosts[j], h.hosts[i]
+	h.hosts[i].index = i
+	h.hosts[j].index = j
+}
+
+func (h *hostHeap) Push(x any) {
+	q := x.(*hostQueue)
+	q.heap, q.index = h, len(h.hosts)
+	h.hosts = append(h.hosts, q)
+}
+
+func (h *hostHeap) Pop() any {
+	n := len(h.hosts) - 1
+	q := h.hosts[n]
+	h.hosts[n] = nil
+	h.hosts = h.hosts[:n]
+	q.heap, q.index = nil, -1
+	return q
+}
+
+func (f *frontier) init() {
+	if f.hosts == nil {
+		f.hosts = make(map[string]*hostQueue)
+		f.ready.less = headBefore
+		f.waiting.less = readyBefore
+	}
+}
+
+func (f *frontier) Len() int {
+	return f.len
+}
+
+// Priority URLs go after the other priority ones, before the rest
+func (f *frontier) Push(item queueItem) {
+	f.init()
+	host := itemHost(item)
+	q, ok := f.hosts[host]
+	if !ok {
+		q = &hostQueue{host: host, index: -1}
+		f.hosts[host] = q
+	}
+	f.seq++
+	if item.Priority {
+		q.priority = append(q.priority, frontierItem{item, f.seq})
+	} else {
+		q.normal = append(q.normal, frontierItem{item, f.seq})
+	}
+	f.len++
+	if q.heap == nil {
+		// Checked against the throttle by the next Pop
+		q.readyAt = time.Time{}
+		heap.Push(&f.waiting, q)
+	} else {
+		heap.Fix(q.heap, q.index)
+	}
+}
+
+// Pop the first URL whose host can be requested now; when every host
+// is paused it returns the URL that will be ready first. The time a
+// host can be requested is checked again when it comes due, as the
+// throttle may have moved it since.
+func (f *frontier) Pop(throttle *hostThrottle) queueItem {
+	f.init()
+	now := time.Now()
+	for {
+		for f.waiting.Len() > 0 && !f.waiting.hosts[0].readyAt.After(now) {
+			q := f.waiting.hosts[0]
+			if wait := throttle.delay(q.host); wait > 0 {
+				q.readyAt = now.Add(wait)
+				heap.Fix(&f.waiting, 0)
+				continue
+			}
+			heap.Pop(&f.waiting)
+			heap.Push(&f.ready, q)
+		}
+		if f.ready.Len() == 0 {
+			break
+		}
+		q := heap.Pop(&f.ready).(*hostQueue)
+		if wait := throttle.delay(q.host); wait > 0 {
+			q.readyAt = now.Add(wait)
+			heap.Push(&f.waiting, q)
+			continue
+		}
+		return f.take(q, now)
+	}
+	if f.waiting.Len() == 0 {
+		return queueItem{}
+	}
+	return f.take(heap.Pop(&f.waiting).(*hostQueue), now)
+}
+
+// Pop the first URL of a host out of the heaps, putting the host back
+// to wait for the request to be done
+func (f *frontier) take(q *hostQueue, now time.Time) queueItem {
+	item := q.pop()
+	f.len--
+	if q.len() == 0 {
+		delete(f.hosts, q.host)
+		return item
+	}
+	q.readyAt = now
+	heap.Push(&f.waiting, q)
+	return item
+}
+
+// Queued URLs in the order they are pushed, priority ones first
+func (f *frontier) ordered() []frontierItem {
+	all := make([]frontierItem, 0, f.len)
+	for _, q := range f.hosts {
+		all = append(all, q.priority...)
+		all = append(all, q.normal...)
+	}
+	slices.SortFunc(all, func(a, b frontierItem) int {
+		if a.item.Priority != b.item.Priority {
+			if a.item.Priority {
+				return -1
+			}
+			return 1
+		}
+		return cmp.Compare(a.seq, b.seq)
+	})
+	return all
+}
+
+// Remove the URLs matching the function, returning how many. The
+// hosts left are checked against the throttle again.
+func (f *frontier) Drop(match func(queueItem) bool) int {
+	f.init()
+	dropped := 0
+	keep := func(items []frontierItem) []frontierItem {
+		kept := items[:0]
+		for _, fi := range items {
+			if match(fi.item) {
+				dropped++
+			} else {
+				kept = append(kept, fi)
+			}
+		}
+		return kept
+	}
+	f.ready.hosts, f.waiting.hosts = nil, nil
+	for host, q := range f.hosts {
+		q.priority, q.normal = keep(q.priority), keep(q.normal)
+		q.heap, q.index = nil, -1
+		if q.len() == 0 {
+			delete(f.hosts, host)
+			continue
+		}
+		q.readyAt = time.Time{}
+		heap.Push(&f.waiting, q)
+	}
+	f.len -= dropped
+	return dropped
+}
+
+// Copy of the number of queued URLs by host
+func (f *frontier) HostLens() map[string]int {
+	hosts := make(map[string]int, len(f.hosts))
+	for host, q := range f.hosts {
+		hosts[host] = q.len()
+	}
+	return hosts
+}
+
+func itemHost(item queueItem) string {
+	u, err := url.Parse(item.URL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+func hostname(urlStr string) string {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFrontierPop(t *testing.T) {
+	tests := []struct {
+		name   string
+		items  []queueItem
+		paused []string
+		want   []string
+	}{
+		{
+			name: "first pushed first",
+			items: []queueItem{
+				{URL: "http://a.com/1"},
+				{URL: "http://a.com/2"},
+				{URL: "http://b.com/1"},
+			},
+			want: []string{"http://a.com/1", "http://a.com/2", "http://b.com/1"},
+		},
+		{
+			name: "priority first",
+			items: []queueItem{
+				{URL: "http://a.com/1"},
+				{URL: "http://b.com/1"},
+				{URL: "http://b.com/2", Priority: true},
+				{URL: "http://a.com/2", Priority: true},
+			},
+			want: []string{"http://b.com/2", "http://a.com/2", "http://a.com/1", "http://b.com/1"},
+		},
+		{
+			name: "paused host last",
+			items: []queueItem{
+				{URL: "http://a.com/1"},
+				{URL: "http://b.com/1"},
+				{URL: "http://a.com/2"},
+				{URL: "http://b.com/2"},
+			},
+			paused: []string{"a.com"},
+			want:   []string{"http://b.com/1", "http://b.com/2", "http://a.com/1", "http://a.com/2"},
+		},
+		{
+			name: "every host paused",
+			items: []queueItem{
+				{URL: "http://a.com/1"},
+				{URL: "http://b.com/1"},
+			},
+			paused: []string{"a.com", "b.com"},
+			want:   []string{"http://a.com/1", "http://b.com/1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			throttle := newHostThrottle(0, 0, false)
+			for i, host := range tt.paused {
+				// Paused hosts come due in this order
+				throttle.pause(host, time.Hour+time.Duration(i)*time.Minute)
+			}
+			f := &frontier{}
+			for _, item := range tt.items {
+				f.Push(item)
+			}
+			var got []string
+			for f.Len() > 0 {
+				got = append(got, f.Pop(throttle).URL)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+			if item := f.Pop(throttle); item.URL != "" {
+				t.Errorf("empty frontier returned %s", item.URL)
+			}
+		})
+	}
+}
+
+func TestFrontierDrop(t *testing.T) {
+	f := &frontier{}
+	for _, u := range []string{"http://a.com/1", "http://b.com/1", "http://a.com/2"} {
+		f.Push(queueItem{URL: u})
+	}
+	dropped := f.Drop(func(item queueItem) bool { return itemHost(item) == "a.com" })
+	if dropped != 2 || f.Len() != 1 {
+		t.Fatalf("dropped %d, %d left, want 2 and 1", dropped, f.Len())
+	}
+	if item := f.Pop(newHostThrottle(0, 0, false)); item.URL != "http://b.com/1" {
+		t.Errorf("got %s, want http://b.com/1", item.URL)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Parse the -allow-domains list, e.g. example.com,*.example.org
+func parseAllowDomains(value string) ([]string, error) {
+	var domains []string
+	for _, domain := range strings.Split(value, ",") {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if domain == "" {
+			continue
+		}
+		name := strings.TrimPrefix(domain, "*.")
+		if name == "" || strings.Contains(name, "*") {
+			return nil, fmt.Errorf("invalid -allow-domains %s, expected a domain or *.domain", domain)
+		}
+		if strings.HasPrefix(domain, "*.") {
+			domains = append(domains, "*."+asciiHost(name))
+		} else {
+			domains = append(domains, asciiHost(name))
+		}
+	}
+	return domains, nil
+}
+
+// The host is one of AllowDomains; *.example.com matches the
+// subdomains of example.com, not example.com itself
+func (c *Crawler) allowedDomain(host string) bool {
+	for _, domain := range c.AllowDomains {
+		if suffix, ok := strings.CutPrefix(domain, "*"); ok {
+			if strings.HasSuffix(host, suffix) {
+				return true
+			}
+		} else if host == domain {
+			return true
+		}
+	}
+	return false
+}
+
+// State file of the host when the state is sharded: state.json
+// becomes state.example.com.json
+func shardStateFile(stateFile, host string) string {
+	ext := filepath.Ext(stateFile)
+	return strings.TrimSuffix(stateFile, ext) + "." + sanitizeSegment(host) + ext
+}
+
+// State files of the hosts
+func stateShardFiles(stateFile string) ([]string, error) {
+	ext := filepath.Ext(stateFile)
+	return filepath.Glob(strings.TrimSuffix(stateFile, ext) + ".*" + ext)
+}
+
+// Add the records of the host state files to the state
+func loadStateShards(stateFile string, state State) error {
+	files, err := stateShardFiles(stateFile)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		shard, err := loadState(file)
+		if err != nil {
+			return fmt.Errorf("loading %s: %v", file, err)
+		}
+		for url, rec := range shard {
+			state[url] = rec
+		}
+	}
+	return nil
+}
+
+// Load the state and its host files, telling whether there are any
+func loadShardedState(stateFile string) (State, bool, error) {
+	state, err := loadState(stateFile)
+	if err != nil {
+		return nil, false, err
+	}
+	files, err := stateShardFiles(stateFile)
+	if err != nil || len(files) == 0 {
+		return state, false, err
+	}
+	return state, true, loadStateShards(stateFile, state)
+}
+
+// Save the state split in host files, emptying the ones of the hosts
+// left without records and the state file itself, which the crawler
+// reads along with them
+func saveShardedState(state State, stateFile string) error {
+	shards := shardState(state)
+	files, err := stateShardFiles(stateFile)
+	if err != nil {
+		return err
+	}
+	written := make(map[string]bool)
+	for host, shard := range shards {
+		file := shardStateFile(stateFile, host)
+		if err := saveState(shard, file); err != nil {
+			return err
+		}
+		written[file] = true
+	}
+	for _, file := range files {
+		if !written[file] {
+			if err := saveState(make(State), file); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := os.Stat(stateFile); err == nil {
+		return saveState(make(State), stateFile)
+	}
+	return nil
+}
+
+// Split the state by host
+func shardState(state State) map[string]State {
+	shards := make(map[string]State)
+	for url, rec := range state {
+		host := hostname(url)
+		if shards[host] == nil {
+			shards[host] = make(State)
+		}
+		shards[host][url] = rec
+	}
+	return shards
+}
+
+// Save only the state of the host of the URL
+func (c *Crawler) saveShard(urlStr string, rec PageRecord) error {
+	host := hostname(urlStr)
+	if c.shards[host] == nil {
+		c.shards[host] = make(State)
+	}
+	c.shards[host][urlStr] = rec
+	return saveState(c.shards[host], shardStateFile(c.StateFile, host))
+}
+
+// Print the counters of every host
+func (c *Crawler) printHosts() {
+	hosts := c.progress.hostsSnapshot()
+	if len(hosts) == 0 {
+		return
+	}
+	names := make([]string, 0, len(hosts))
+	for host := range hosts {
+		names = append(names, host)
+	}
+	sort.Strings(names)
+	fmt.Println("Hosts:")
+	for _, host := range names {
+		stats := hosts[host]
+		fmt.Printf("  %s: %d requests, %d errors, %d saved (%d bytes), %d queued\n",
+			host, stats.Pages, stats.Errors, stats.Saved, stats.Bytes, stats.Queued)
+	}
+}
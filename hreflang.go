@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Alternate versions of the page by hreflang ("en-US", "x-default"),
+// resolved against the page URL
+func hreflangLinks(doc *html.Node, base *url.URL) map[string]string {
+	var alternates map[string]string
+	var find func(*html.Node)
+	find = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "link" {
+			lang, href := getAttr(n, "hreflang"), getAttr(n, "href")
+			rels := strings.Fields(strings.ToLower(getAttr(n, "rel")))
+			if lang != "" && href != "" && slices.Contains(rels, "alternate") {
+				if ref, err := url.Parse(href); err == nil {
+					if alternates == nil {
+						alternates = make(map[string]string)
+					}
+					alternates[lang] = base.ResolveReference(ref).String()
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			find(c)
+		}
+	}
+	find(doc)
+	return alternates
+}
+
+// With Languages the alternates in other languages are never crawled;
+// with FollowHreflang the ones in the selected languages are queued
+func (c *Crawler) handleAlternates(alternates map[string]string, page *url.URL, depth int) {
+	for lang, link := range alternates {
+		u, err := url.Parse(link)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			continue
+		}
+		c.normalize(u)
+		link = u.String()
+		if link == page.String() {
+			continue
+		}
+		selected := len(c.Languages) == 0 || c.Languages[primaryLanguage(lang)]
+		if !selected {
+			if c.otherVariants == nil {
+				c.otherVariants = make(map[string]bool)
+			}
+			c.otherVariants[link] = true
+			continue
+		}
+		if c.FollowHreflang && c.inScope(u) {
+			c.enqueue(queueItem{URL: link, Referrer: page.String(), Depth: depth})
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// Remember the hosts served over HTTPS: the ones redirecting http://
+// to https:// and the ones sending Strict-Transport-Security
+func (c *Crawler) noteHTTPS(resp *http.Response, redirects []RedirectHop) {
+	if c.httpsHosts == nil {
+		c.httpsHosts = make(map[string]bool)
+	}
+	chain := make([]*url.URL, 0, len(redirects)+1)
+	for _, hop := range redirects {
+		if u, err := url.Parse(hop.URL); err == nil {
+			chain = append(chain, u)
+		}
+	}
+	chain = append(chain, resp.Request.URL)
+	for i := 1; i < len(chain); i++ {
+		from, to := chain[i-1], chain[i]
+		if from.Scheme == "http" && to.Scheme == "https" && from.Hostname() == to.Hostname() {
+			c.httpsHosts[to.Hostname()] = true
+		}
+	}
+	final := resp.Request.URL
+	if final.Scheme == "https" && resp.Header.Get("Strict-Transport-Security") != "" {
+		c.httpsHosts[final.Hostname()] = true
+	}
+}
+
+// Use https:// for hosts known to serve HTTPS, or for every
+// host with UpgradeHTTPS, so both variants are the same page
+func (c *Crawler) upgradeScheme(u *url.URL) {
+	if u.Scheme != "http" || !(c.UpgradeHTTPS || c.httpsHosts[u.Hostname()]) {
+		return
+	}
+	u.Scheme = "https"
+	if u.Port() == "80" {
+		u.Host = u.Hostname()
+	}
+}
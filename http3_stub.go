@@ -0,0 +1,12 @@
+//go:build !http3
+
+package main
+
+import "net/http"
+
+// HTTP/3 needs quic-go: build with -tags http3
+const http3Supported = false
+
+func newHTTP3Transport(resolver *dnsResolver) http.RoundTripper {
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+// Convert the host to punycode, keeping the port
+func asciiHost(host string) string {
+	hostname, port, err := net.SplitHostPort(host)
+	if err != nil {
+		hostname, port = host, ""
+	}
+	ascii, err := idna.Lookup.ToASCII(hostname)
+	if err != nil {
+		return host
+	}
+	if port != "" {
+		return net.JoinHostPort(ascii, port)
+	}
+	return ascii
+}
+
+// Readable form of a punycode host name, used for directory names
+func unicodeHost(hostname string) string {
+	name, err := idna.Display.ToUnicode(hostname)
+	if err != nil {
+		return hostname
+	}
+	return name
+}
+
+// Punycode host and percent-encoded non-ASCII path and query, as
+// they are sent on the wire
+func normalizeIDN(u *url.URL) {
+	if u.Host != "" {
+		u.Host = asciiHost(strings.ToLower(u.Host))
+	}
+	// String() escapes the path unless RawPath holds raw non-ASCII bytes
+	if u.RawPath != "" && !isASCII(u.RawPath) {
+		u.RawPath = ""
+	}
+	if !isASCII(u.RawQuery) {
+		u.RawQuery = escapeNonASCII(u.RawQuery)
+	}
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+func escapeNonASCII(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			fmt.Fprintf(&b, "%%%02X", s[i])
+		} else {
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
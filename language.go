@@ -0,0 +1,120 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+)
+
+// Common words used to guess the language of a page without a lang attribute
+var stopwords = map[string][]string{
+	"en": {"the", "and", "of", "to", "is", "in", "that", "it", "for", "with", "was", "this"},
+	"it": {"il", "di", "che", "la", "e", "per", "un", "non", "sono", "della", "con", "gli"},
+	"fr": {"le", "la", "les", "et", "des", "est", "une", "que", "pour", "dans", "pas", "sur"},
+	"de": {"der", "die", "und", "das", "ist", "nicht", "mit", "ein", "den", "auf", "sich", "auch"},
+	"es": {"el", "los", "las", "que", "y", "en", "es", "por", "una", "para", "con", "del"},
+	"pt": {"o", "os", "que", "e", "do", "da", "em", "um", "para", "com", "não", "uma"},
+	"nl": {"de", "het", "een", "en", "van", "is", "dat", "niet", "op", "te", "zijn", "voor"},
+}
+
+// Visible text of the page, without scripts and styles
+func pageText(doc *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && (n.Data == "script" || n.Data == "style" || n.Data == "noscript") {
+			return
+		}
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+			b.WriteByte(' ')
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return b.String()
+}
+
+// Primary language subtag ("en" for "en-US") declared by the page
+func declaredLanguage(doc *html.Node) string {
+	lang := ""
+	var find func(*html.Node)
+	find = func(n *html.Node) {
+		if lang != "" {
+			return
+		}
+		if n.Type == html.ElementNode {
+			switch {
+			case n.Data == "html":
+				lang = getAttr(n, "lang")
+			case n.Data == "meta" && strings.EqualFold(getAttr(n, "http-equiv"), "content-language"):
+				lang = getAttr(n, "content")
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			find(c)
+		}
+	}
+	find(doc)
+	return primaryLanguage(lang)
+}
+
+// Primary subtag of a language tag
+func primaryLanguage(tag string) string {
+	primary, _, _ := strings.Cut(strings.ToLower(tag), "-")
+	primary, _, _ = strings.Cut(primary, "_")
+	primary, _, _ = strings.Cut(primary, ",")
+	return strings.TrimSpace(primary)
+}
+
+// Guess the language counting the stopwords of every language
+func detectLanguage(text string) string {
+	counts := make(map[string]int)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	index := make(map[string][]string)
+	for lang, list := range stopwords {
+		for _, w := range list {
+			index[w] = append(index[w], lang)
+		}
+	}
+	for _, w := range words {
+		for _, lang := range index[w] {
+			counts[lang]++
+		}
+	}
+	best, bestCount := "", 0
+	for lang, n := range counts {
+		if n > bestCount || (n == bestCount && lang < best) {
+			best, bestCount = lang, n
+		}
+	}
+	// Too little evidence
+	if bestCount < 3 {
+		return ""
+	}
+	return best
+}
+
+// Language of the page: the declared one, or the detected one
+func pageLanguage(doc *html.Node) string {
+	if lang := declaredLanguage(doc); lang != "" {
+		return lang
+	}
+	return detectLanguage(pageText(doc))
+}
+
+// Parse a comma separated list of language codes
+func parseLanguages(value string) map[string]bool {
+	languages := make(map[string]bool)
+	for _, l := range strings.Split(value, ",") {
+		if l = strings.ToLower(strings.TrimSpace(l)); l != "" {
+			languages[l] = true
+		}
+	}
+	return languages
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"bytes"
-	"encoding/json"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"flag"
 	"fmt"
@@ -10,169 +12,1333 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
 	"path"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
 )
 
-// Map for the crawler status
-type State map[string]bool
+// Crawler holds the configuration and the status of a crawl
+type Crawler struct {
+	StartURL  string
+	DestDir   string
+	StateFile string
+	// Records fetched longer ago are dropped when the state is loaded,
+	// so their URLs are crawled again
+	StateTTL time.Duration
+	// Interval between the checkpoints of the crawl (none if 0), and
+	// checkpoint to roll back to before starting (none if 0)
+	CheckpointEvery   time.Duration
+	RestoreCheckpoint int
+	// Daily window the crawl runs in, paused outside it (always if nil)
+	ActiveHours *activeHours
+	// Send the page where a URL was found as Referer header
+	SendReferer bool
+	// Visited set: "map" (default), "hash" or "bloom". The hits of
+	// the bloom filter are confirmed against the hashes of the
+	// visited URLs kept on disk.
+	VisitedMode string
+	// Expected number of URLs and false positive rate of the bloom filter
+	ExpectedURLs int
+	BloomFPRate  float64
+	// Directory of the HTTP cache, disabled when empty
+	CacheDir string
+	// DNS server (host:port), cache TTL, preferred IP version
+	// ("ipv4" or "ipv6") and fixed host to IP mappings
+	DNSServer string
+	DNSTTL    time.Duration
+	PreferIP  string
+	Resolve   map[string]string
+	// Fetchers of the schemes other than http and https, by scheme;
+	// ftp://, and file:// when starting from a local file, if nil
+	Fetchers map[string]Fetcher
+	// Directory where every response is recorded, and directory of
+	// the recorded responses replayed instead of using the network
+	RecordDir string
+	ReplayDir string
+	// Signs every HTTP request before it is sent, if not nil
+	Signer RequestSigner
+	// Browser headers sent with the requests, a random profile for
+	// every request, or for every host with RotateByHost
+	HeaderProfiles []HeaderProfile
+	RotateByHost   bool
+	// HTTP version: "auto", "1.1", "2" or "3"
+	HTTPVersion string
+	// Delay between requests to the same host, randomized by ±Jitter
+	// (a fraction of the delay); AdaptiveDelay slows down the hosts
+	// answering 429/503 or getting slower
+	Delay         time.Duration
+	Jitter        float64
+	AdaptiveDelay bool
+	// How many times a URL answered with 429/503 and Retry-After is re-queued
+	MaxRetries int
+	// A host failing (network errors, 429, 5xx) at least BreakerRate
+	// of its last BreakerWindow requests is paused for BreakerCooldown,
+	// longer if it keeps failing; a failed request is then retried
+	// rather than stopping the crawl. Disabled if BreakerWindow is 0.
+	BreakerWindow   int
+	BreakerRate     float64
+	BreakerCooldown time.Duration
+	// Actions by status code or class, e.g. "404" or "5xx"
+	StatusPolicies map[string]StatusAction
+	// Query strings handling
+	Query QueryPolicy
+	// Download images, scripts and stylesheets of the pages, taking
+	// "all" the srcset candidates or only the "largest"
+	Assets bool
+	Srcset string
+	// File naming: "tree", "flat" or "hash"
+	Naming string
+	// Longest absolute path of a saved file, longer paths are shortened
+	// (0 for no limit)
+	MaxPathLength int
+	// Output store: "tree" or "cas" (content-addressable objects
+	// with a manifest)
+	Store string
+	// Follow redirects leaving the host of the start URL
+	OffsiteRedirects bool
+	// Rewrite every http:// link to https://
+	UpgradeHTTPS bool
+	// Deadline of each page, including the download of the body
+	PageTimeout time.Duration
+	// Extensions of the linked files downloaded as they are
+	// (e.g. "pdf"), and the maximum size of a downloaded file
+	DownloadTypes map[string]bool
+	MaxFileSize   int64
+	// Maximum size of the files saved, and free space left on the
+	// volume, the crawl pausing until more is available
+	MaxTotalSize int64
+	MinFreeSpace int64
+	// Languages of the pages saved and followed, every language if empty
+	Languages map[string]bool
+	// Pages must match MatchContent and not match ExcludeContent to be
+	// saved, followed or both, as ContentFilter says ("save", "follow", "both")
+	MatchContent   *regexp.Regexp
+	ExcludeContent *regexp.Regexp
+	ContentFilter  string
+	// Maximum number of pages per domain
+	Budgets map[string]int
+	// Rules rewriting the URLs before they are queued
+	Rewrites []rewriteRule
+	// Save the latest Wayback Machine snapshot of the URLs answering
+	// 404 or 410
+	Wayback bool
+	// Write only the response headers to headers.csv, saving no body;
+	// linked files are requested with HEAD
+	HeadersOnly bool
+	// Save the bytes received ("raw") or the parsed page serialized
+	// again in UTF-8 ("dom"), with links to the local copies if
+	// ConvertLinks
+	Save         string
+	ConvertLinks bool
+	// Transformations of the saved pages: "strip-js" (scripts and
+	// event handlers), "strip-pixels" (1x1 images), "minify", "prettify"
+	Transforms map[string]bool
+	// Follow the URLs opened by onclick handlers and javascript: links
+	HeuristicLinks bool
+	// Pagination pages followed in a row, 0 for no limit
+	MaxPaginationDepth int
+	// Queue the hreflang alternates of the pages in the selected Languages
+	FollowHreflang bool
+	// What to do with the pages nearly identical to one already
+	// crawled: "flag" them or "skip" saving them, nothing if empty
+	NearDuplicates string
+	// Write the SEO data of every page to seo.jsonl and a report of
+	// missing and duplicate titles and descriptions
+	SEOReport bool
+	// Other domains crawled with the one of the start URL, e.g.
+	// example.org or *.example.org for its subdomains
+	AllowDomains []string
+	// Keep the state of every host in its own file, state.<host>.json
+	ShardState bool
+	// Write every link with its anchor text, rel and heading to links.jsonl
+	LinkGraph bool
+	// Save nothing, writing the links to pages out of scope to this
+	// file, CSV if it ends in .csv, JSON lines otherwise
+	OutlinksFile string
+	// Receives the events of the crawl, if not nil
+	Events EventHandler
+	// Every fetched page is written here as a JSON line, if not nil
+	Results io.Writer
+	// Where the URLs to crawl are queued: memory (the default),
+	// disk[:file] or nats://host:port/stream
+	QueueBackend string
+	// Glob patterns of the files to save and to skip, like wget -A/-R
+	Accept []string
+	Reject []string
 
-func crawl(url, stateFile string, startURL string, destDir string) (State, error) {
+	// Links dropped by the URL filter
+	Filtered FilterStats
+
+	client       *http.Client
+	state        State
+	visited      Visited
+	visitedLog   *os.File
+	metaFile     *os.File
+	manifestFile *os.File
+	checksumFile *os.File
+	headersFile  *os.File
+	seoFile      *os.File
+	outlinksFile *os.File
+	edgesFile    *os.File
+	outlinksSeen map[string]bool
+	seo          *seoIndex
+	simIndex     *simIndex
+	caseNames    map[string]string
+	httpsHosts   map[string]bool
+	spent        map[string]int
+	savedBytes   int64
+	queue        Queue
+	throttle     *hostThrottle
+	breaker      *circuitBreaker
+	progress     progress
+	control      control
+	// Called for every URL marked as visited
+	onPage func(url string, rec PageRecord)
+	// Alternates in languages not selected
+	otherVariants map[string]bool
+	// Hosts of the links of a local start page
+	seedHosts map[string]bool
+	// State by host, with ShardState
+	shards map[string]State
+	// URLs queued once, not to queue them again
+	queued Visited
+	// Transport of the requests to other services, like the Wayback
+	// Machine: no signing, header rotation or cache
+	plainTransport http.RoundTripper
+	// Directories listed for caseNames
+	caseDirs map[string]bool
+}
+
+func (c *Crawler) crawl(ctx context.Context, url string) (State, error) {
+	var restored *checkpoint
+	if c.RestoreCheckpoint > 0 {
+		cp, err := c.restoreCheckpoint(c.RestoreCheckpoint)
+		if err != nil {
+			return nil, err
+		}
+		restored = cp
+	}
 	// Load the status
-	state, err := loadState(stateFile)
+	state, err := loadState(c.StateFile)
 	if err != nil {
 		return state, err
 	}
-	err = processPage(url, state, startURL, destDir, stateFile)
-	return state, err
-}
-
-func loadState(stateFile string) (map[string]bool, error) {
-	state := make(map[string]bool)
-	if _, err := os.Stat(stateFile); err == nil {
-		file, err := os.Open(stateFile)
+	if c.ShardState {
+		if err := loadStateShards(c.StateFile, state); err != nil {
+			return state, err
+		}
+	}
+	if c.StateTTL > 0 {
+		if dropped := compactState(state, c.StateTTL, nil, time.Now()); dropped > 0 {
+			fmt.Printf("Dropped %d records older than %s\n", dropped, c.StateTTL)
+		}
+	}
+	c.state = state
+	if c.ShardState {
+		c.shards = shardState(state)
+	}
+	c.savedBytes = savedSize(state)
+	if c.Fetchers == nil {
+		c.Fetchers = defaultFetchers(c.StartURL)
+	}
+	c.client, err = c.newClient()
+	if err != nil {
+		return state, err
+	}
+	c.queued = newQueuedSet(c.VisitedMode)
+	c.visited, err = newVisited(c.VisitedMode, state, c.StateFile, c.ExpectedURLs, c.BloomFPRate)
+	if err != nil {
+		return state, err
+	}
+	if c.compactVisited() {
+		for u := range state {
+			c.visited.Add(u)
+		}
+		logFile := visitedLogFile(c.StateFile)
+		if err := loadVisitedLog(logFile, c.visited, c.StateTTL); err != nil {
+			return state, err
+		}
+		if b, ok := c.visited.(*confirmedBloom); ok {
+			if err := b.store.flush(); err != nil {
+				return state, err
+			}
+		}
+		c.visitedLog, err = os.OpenFile(logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 		if err != nil {
-			return nil, err
+			return state, err
 		}
-		defer file.Close()
-
-		decoder := json.NewDecoder(file)
-		if err := decoder.Decode(&state); err != nil {
-			return nil, err
+		defer c.visitedLog.Close()
+	}
+	defer func() {
+		if c.metaFile != nil {
+			c.metaFile.Close()
+		}
+		if c.manifestFile != nil {
+			c.manifestFile.Close()
+		}
+		if c.checksumFile != nil {
+			c.checksumFile.Close()
+		}
+		if c.headersFile != nil {
+			c.headersFile.Close()
+		}
+		if c.seoFile != nil {
+			c.seoFile.Close()
+		}
+		if c.outlinksFile != nil {
+			c.outlinksFile.Close()
+		}
+		if c.edgesFile != nil {
+			c.edgesFile.Close()
+		}
+	}()
+	c.queue, err = newQueue(c.QueueBackend, c.StateFile)
+	if err != nil {
+		return state, err
+	}
+	defer c.queue.Close()
+	// Before closing the queue, which may empty it
+	defer func() {
+		if err := c.saveFrontier(); err != nil {
+			fmt.Println("Error saving the frontier:", err)
+		}
+	}()
+	if c.throttle == nil {
+		c.throttle = newHostThrottle(c.Delay, c.Jitter, c.AdaptiveDelay)
+	}
+	if c.BreakerWindow > 0 {
+		c.breaker = newCircuitBreaker(c.BreakerWindow, c.BreakerRate)
+	}
+	start := c.normalizeURL(url)
+	if restored != nil {
+		c.spent = restored.Spent
+		for _, item := range restored.Queue {
+			c.queued.Add(item.URL)
+			c.queue.Push(item)
+		}
+	} else {
+		// Like the first time, a resumed crawl fetches the start page
+		// again, then the URLs left queued by the last one
+		c.queued.Add(start)
+		c.queue.Push(queueItem{URL: start})
+		c.progress.link("queued")
+		pending, err := loadFrontier(frontierFile(c.StateFile))
+		if err != nil {
+			return state, err
+		}
+		for _, item := range pending {
+			if !c.visited.Has(item.URL) && !c.queued.Has(item.URL) {
+				c.queued.Add(item.URL)
+				c.queue.Push(item)
+			}
+		}
+	}
+	lastCheckpoint := time.Now()
+	for c.queue.Len() > 0 {
+		if err := c.queue.Err(); err != nil {
+			return state, err
+		}
+		if err := visitedErr(c.visited); err != nil {
+			return state, err
+		}
+		if err := c.control.waitResumed(ctx); err != nil {
+			return state, err
+		}
+		if err := c.waitActiveHours(ctx); err != nil {
+			return state, err
+		}
+		for _, host := range c.control.takeSkipped() {
+			dropped := c.queue.Drop(func(item queueItem) bool { return itemHost(item) == host })
+			fmt.Printf("Skipping host %s, dropped %d URLs\n", host, dropped)
+		}
+		if c.queue.Len() == 0 {
+			break
+		}
+		item := c.queue.Pop(c.throttle)
+		if item.URL == "" {
+			continue
+		}
+		// The host may have switched to HTTPS since the URL was queued
+		item.URL = c.normalizeURL(item.URL)
+		// Retries go through: a download redirected elsewhere has
+		// the URL first requested marked as an alias already
+		if c.visited.Has(item.URL) && item.URL != start && item.Attempts == 0 {
+			continue
+		}
+		host := hostname(item.URL)
+		// Budgets count the pages: their assets are still fetched
+		if !item.Asset && c.budgetExhausted(host) {
+			continue
+		}
+		// Retries were already counted
+		if !item.Asset && item.Attempts == 0 {
+			c.spendBudget(host)
+		}
+		c.progress.setQueued(c.queue.HostLens())
+		c.progress.set("waiting", item.URL, c.queue.Len())
+		if err := c.throttle.wait(ctx, itemHost(item)); err != nil {
+			c.queue.Push(item)
+			return state, err
+		}
+		c.progress.set("processing", item.URL, c.queue.Len())
+		pageCtx, end := startSpan(ctx, "page", item.URL)
+		err := c.processPage(pageCtx, item)
+		end(err)
+		if err != nil {
+			c.events().OnError(ErrorEvent{URL: item.URL, Err: err, Fatal: true})
+			// Not visited: left in the frontier for the next crawl
+			c.queue.Push(item)
+			return state, err
+		}
+		if c.CheckpointEvery > 0 && time.Since(lastCheckpoint) >= c.CheckpointEvery {
+			if err := c.writeCheckpoint(); err != nil {
+				return state, err
+			}
+			lastCheckpoint = time.Now()
 		}
 	}
-	return state, nil
+	if err := c.queue.Err(); err != nil {
+		return state, err
+	}
+	c.progress.setQueued(c.queue.HostLens())
+	c.progress.set("done", "", 0)
+	if err := c.writeSEOReport(); err != nil {
+		return state, err
+	}
+	return state, c.writeNearDuplicates()
+}
+
+// Apply the rewrite rules, IDN encoding, the query policy and the
+// scheme upgrade to the URL
+func (c *Crawler) normalize(u *url.URL) {
+	c.rewriteURL(u)
+	normalizeIDN(u)
+	c.Query.apply(u)
+	c.upgradeScheme(u)
 }
 
-func saveState(state map[string]bool, stateFile string) error {
-	file, err := os.Create(stateFile)
+func (c *Crawler) normalizeURL(link string) string {
+	u, err := url.Parse(link)
 	if err != nil {
-		return err
+		return link
 	}
-	defer file.Close()
+	c.normalize(u)
+	return u.String()
+}
 
-	encoder := json.NewEncoder(file)
-	if err := encoder.Encode(state); err != nil {
-		return err
+// Add a URL to the queue if it was never seen
+func (c *Crawler) enqueue(item queueItem) {
+	if c.visited.Has(item.URL) {
+		c.progress.link("duplicate")
+		return
+	}
+	if c.queued.Has(item.URL) {
+		c.progress.link("duplicate")
+		return
+	}
+	if c.control.hostSkipped(itemHost(item)) {
+		c.skipped(item.URL, "host skipped")
+		return
+	}
+	if c.otherVariants[item.URL] {
+		fmt.Printf("Skip %s, language variant not selected\n", item.URL)
+		c.skipped(item.URL, "language variant not selected")
+		return
+	}
+	if u, err := url.Parse(item.URL); err == nil && item.Referrer != "" {
+		if c.rejected(u) || (item.Asset && !c.accepted(u)) {
+			fmt.Printf("Skip %s, rejected by pattern\n", item.URL)
+			c.skipped(item.URL, "rejected by pattern")
+			return
+		}
+	}
+	c.queued.Add(item.URL)
+	c.queue.Push(item)
+	c.progress.link("queued")
+}
+
+func (c *Crawler) compactVisited() bool {
+	return c.VisitedMode == "hash" || c.VisitedMode == "bloom"
+}
+
+// Page visited
+func (c *Crawler) markVisited(urlStr string, rec PageRecord) error {
+	if c.onPage != nil {
+		c.onPage(urlStr, rec)
+	}
+	if rec.SavePath != "" {
+		c.progress.saved(itemHost(queueItem{URL: urlStr}), rec.Size)
+		c.events().OnSave(SaveEvent{URL: urlStr, Path: rec.SavePath, Size: rec.Size, Hash: rec.Hash, Depth: rec.Depth})
+	}
+	if c.visitedLog != nil {
+		c.visited.Add(urlStr)
+		return appendVisitedLog(c.visitedLog, urlStr, rec)
+	}
+	c.state[urlStr] = rec
+	if c.ShardState {
+		return c.saveShard(urlStr, rec)
+	}
+	// Save the new state
+	return saveState(c.state, c.StateFile)
+}
+
+// The URLs of the redirect chain are aliases of the final one
+func (c *Crawler) markAliases(redirects []RedirectHop, final string, depth int) error {
+	for _, hop := range redirects {
+		if err := c.markVisited(hop.URL, PageRecord{Status: hop.Status, FetchedAt: time.Now(), Depth: depth, AliasOf: final}); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-// Recursive function to process the page
-func processPage(urlStr string, state State, startURL string, destDir string, stateFile string) error {
+// Get the page, sending the referrer if requested
+func (c *Crawler) fetch(ctx context.Context, item queueItem) (*http.Response, error) {
+	ctx = context.WithValue(ctx, assetRequestKey{}, item.Asset)
+	method := http.MethodGet
+	if item.Asset && c.HeadersOnly {
+		method = http.MethodHead
+	}
+	req, err := http.NewRequestWithContext(ctx, method, item.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.SendReferer && item.Referrer != "" {
+		req.Header.Set("Referer", item.Referrer)
+	}
+	if item.Asset && c.Store != "cas" && !c.HeadersOnly {
+		c.addRangeHeaders(req)
+	}
+	ctx, end := startSpan(ctx, "fetch", item.URL)
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err == nil {
+		spanStatus(ctx, resp.StatusCode)
+	}
+	end(err)
+	return resp, err
+}
 
-	resp, err := http.Get(urlStr)
+// Fetch and save the page, then queue its links
+func (c *Crawler) processPage(crawlCtx context.Context, item queueItem) error {
+	ctx := crawlCtx
+	if c.PageTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(crawlCtx, c.PageTimeout)
+		defer cancel()
+	}
+	urlStr, referrer := item.URL, item.Referrer
+	started := time.Now()
+	resp, err := c.fetch(ctx, item)
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode
+	}
+	latency := time.Since(started)
+	c.throttle.done(itemHost(item), status, latency)
+	c.progress.fetched(itemHost(item), status, latency)
+	if err != nil && ctx.Err() != nil {
+		return pageCanceled(crawlCtx, urlStr)
+	}
+	c.checkHealth(itemHost(item), status)
+	if resp != nil {
+		c.events().OnFetch(FetchEvent{
+			URL:      urlStr,
+			Status:   status,
+			Protocol: resp.Proto,
+			Latency:  latency,
+			Attempt:  item.Attempts,
+			Depth:    item.Depth,
+		})
+	}
+	if errors.Is(err, errRedirectOutOfScope) || errors.Is(err, errRedirectScheme) {
+		fmt.Printf("Skip %s, %v\n", urlStr, err)
+		c.skipped(urlStr, err.Error())
+		return c.markVisited(urlStr, PageRecord{FetchedAt: time.Now(), Depth: item.Depth, Referrer: referrer})
+	}
+	if err != nil && c.breaker != nil {
+		// The host may come back: try again later
+		if item.Attempts >= c.MaxRetries {
+			fmt.Printf("Giving up on %s after %d retries: %v\n", urlStr, item.Attempts, err)
+			c.events().OnError(ErrorEvent{URL: urlStr, Err: err})
+			return c.markVisited(urlStr, PageRecord{FetchedAt: time.Now(), Depth: item.Depth, Referrer: referrer})
+		}
+		fmt.Printf("Failed to get %s, it will be retried: %v\n", urlStr, err)
+		c.events().OnError(ErrorEvent{URL: urlStr, Err: err})
+		item.Attempts++
+		c.queue.Push(item)
+		return nil
+	}
 	if err != nil {
+		if referrer != "" {
+			return fmt.Errorf("failed to get URL %s (linked from %s): %v", urlStr, referrer, err)
+		}
 		return fmt.Errorf("failed to get URL %s: %v", urlStr, err)
 	}
-	bodyBytes, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		if wait, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			resp.Body.Close()
+			if item.Attempts >= c.MaxRetries {
+				fmt.Printf("Giving up on %s after %d retries\n", urlStr, item.Attempts)
+				c.skipped(urlStr, fmt.Sprintf("status %d after %d retries", resp.StatusCode, item.Attempts))
+				return nil
+			}
+			fmt.Printf("Got %d for %s, pausing %s for %s\n", resp.StatusCode, urlStr, itemHost(item), wait)
+			c.throttle.pause(itemHost(item), wait)
+			item.Attempts++
+			c.queue.Push(item)
+			return nil
+		}
+	}
+	if c.Wayback && !c.HeadersOnly && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone) {
+		snapshot, err := c.waybackFallback(ctx, resp)
+		switch {
+		case err != nil && ctx.Err() != nil:
+			resp.Body.Close()
+			return pageCanceled(crawlCtx, urlStr)
+		case err != nil:
+			fmt.Printf("No Wayback snapshot of %s: %v\n", urlStr, err)
+		case snapshot != nil:
+			fmt.Printf("Got %d for %s, using the Wayback snapshot %s\n", resp.StatusCode, urlStr, snapshot.Header.Get(waybackHeader))
+			resp.Body.Close()
+			resp = snapshot
+		}
+	}
+	if c.HeadersOnly {
+		if err := c.writeHeaders(resp); err != nil {
+			resp.Body.Close()
+			return err
+		}
+	}
+	if done, err := c.applyStatusPolicy(item, resp); done {
+		return err
+	}
+	if c.resumable(item, resp) {
+		return c.saveDownload(crawlCtx, item, resp)
+	}
+	bodyBytes, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil && ctx.Err() != nil {
+		return pageCanceled(crawlCtx, urlStr)
+	}
 	resp.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
 	defer resp.Body.Close()
 
-	// Parse HTML content
-	doc, err := html.Parse(resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to parse HTML content: %v", err)
+	var doc *html.Node
+	if !item.Asset {
+		// Parse HTML content
+		_, end := startSpan(ctx, "parse", urlStr)
+		var body io.Reader = resp.Body
+		if c.renderPages() {
+			// Decoded to UTF-8 as it is saved
+			if decoded, err := charset.NewReader(resp.Body, resp.Header.Get("Content-Type")); err == nil {
+				body = decoded
+			}
+		}
+		doc, err = html.Parse(body)
+		end(err)
+		if err != nil {
+			return fmt.Errorf("failed to parse HTML content: %v", err)
+		}
 	}
 
-	// Find all <a> tags and extract their href attributes
-	var links []string
-	var findLinks func(*html.Node)
-	findLinks = func(n *html.Node) {
-		if n.Type == html.ElementNode && n.Data == "a" {
-			for _, attr := range n.Attr {
-				if attr.Key == "href" {
-					links = append(links, attr.Val)
-				}
+	// Content is saved under the final URL, the others are aliases
+	redirects := redirectChain(resp)
+	u := resp.Request.URL
+	if err := c.markAliases(redirects, u.String(), item.Depth); err != nil {
+		return err
+	}
+	c.noteHTTPS(resp, redirects)
+	if finalURL := u.String(); finalURL != urlStr {
+		if c.visited.Has(finalURL) {
+			return nil
+		}
+		urlStr = finalURL
+	}
+	rec := PageRecord{
+		Status:    resp.StatusCode,
+		FetchedAt: time.Now(),
+		Size:      int64(len(bodyBytes)),
+		Depth:     item.Depth,
+		Referrer:  referrer,
+	}
+	if doc != nil {
+		if redirected, err := c.followRefresh(doc, u, rec); redirected || err != nil {
+			return err
+		}
+	}
+	if doc != nil && len(c.Languages) > 0 {
+		if lang := pageLanguage(doc); !c.Languages[lang] {
+			fmt.Printf("Skip %s, language %q\n", urlStr, lang)
+			c.skipped(urlStr, fmt.Sprintf("language %q", lang))
+			return c.markVisited(urlStr, rec)
+		}
+	}
+
+	var alternates map[string]string
+	if doc != nil {
+		alternates = hreflangLinks(doc, u)
+	}
+	if doc != nil && c.SEOReport {
+		if err := c.recordSEO(doc, resp, u); err != nil {
+			return err
+		}
+	}
+
+	save, follow := true, true
+	if doc != nil {
+		save, follow = c.contentAllowed(bodyBytes)
+	}
+	if !c.accepted(u) {
+		save = false
+	}
+	if doc != nil && c.NearDuplicates != "" {
+		if original, ok := c.nearDuplicate(urlStr, doc); ok {
+			fmt.Printf("%s is a near duplicate of %s\n", urlStr, original)
+			if c.NearDuplicates == "skip" {
+				save = false
+			}
+		}
+	}
+	// Only the links to URLs crawled point to the local copies: when
+	// converting them, the links are queued before the page is rendered
+	queueFirst := doc != nil && c.ConvertLinks && c.renderPages()
+	if queueFirst {
+		if err := c.queueFound(ctx, doc, u, item, save, follow, alternates); err != nil {
+			return err
+		}
+	}
+	switch {
+	case c.HeadersOnly:
+		// Headers already written
+	case c.OutlinksFile != "":
+		// Only the outlinks are written
+	case save:
+		_, end := startSpan(ctx, "save", urlStr)
+		if doc != nil && c.renderPages() {
+			if bodyBytes, err = c.renderDOM(doc, u); err != nil {
+				err = fmt.Errorf("failed to render %s: %v", urlStr, err)
+				end(err)
+				return err
 			}
 		}
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			findLinks(c)
+		if err := c.reserveSpace(crawlCtx, int64(len(bodyBytes))); err != nil {
+			end(err)
+			return err
 		}
+		err := c.saveBody(item, u, bodyBytes, resp, redirects, alternates, &rec)
+		end(err)
+		if err != nil {
+			return err
+		}
+	default:
+		fmt.Printf("Not saving %s, filtered\n", urlStr)
+		c.skipped(urlStr, "filtered")
 	}
-	findLinks(doc)
+	if err := c.markVisited(urlStr, rec); err != nil {
+		return err
+	}
+	if err := c.writeResult(urlStr, rec, doc, u); err != nil {
+		return err
+	}
+	if queueFirst {
+		return nil
+	}
+	return c.queueFound(ctx, doc, u, item, save, follow, alternates)
+}
 
-	u, err := url.Parse(urlStr)
-	if err != nil {
-		fmt.Printf("failed to parse URL %s: %v", urlStr, err)
+// Queue the links and assets of the page, writing its link graph
+// and outlinks
+func (c *Crawler) queueFound(ctx context.Context, doc *html.Node, u *url.URL, item queueItem, save, follow bool, alternates map[string]string) error {
+	if item.Asset || !follow {
+		return nil
+	}
+	_, end := startSpan(ctx, "extract", u.String())
+	if c.LinkGraph {
+		if err := c.writeEdges(doc, u); err != nil {
+			end(err)
+			return err
+		}
+	}
+	if c.OutlinksFile != "" {
+		if err := c.writeOutlinks(doc, u); err != nil {
+			end(err)
+			return err
+		}
+	} else if c.Assets && save {
+		c.queueAssets(doc, u, item.Depth+1)
 	}
+	c.handleAlternates(alternates, u, item.Depth+1)
+	c.queueLinks(doc, u, item)
+	end(nil)
+	return nil
+}
 
-	savePath := path.Join(destDir, u.Hostname(), u.Path)
-	err = savePage(bodyBytes, savePath) //! TODO can be concurrent
+// Save the body of the page fetched from u, filling the record
+func (c *Crawler) saveBody(item queueItem, u *url.URL, bodyBytes []byte, resp *http.Response, redirects []RedirectHop, alternates map[string]string, rec *PageRecord) error {
+	urlStr := u.String()
+	savePath := c.localPath(u)
+	if item.Asset && isStylesheet(resp, u) {
+		rewritten := c.processStylesheet(bodyBytes, u, savePath, item.Depth+1)
+		// Objects keep the bytes received
+		if c.Store != "cas" {
+			bodyBytes = rewritten
+		}
+	}
+	var err error
+	if c.Store == "cas" {
+		savePath, err = c.saveObject(urlStr, bodyBytes, resp)
+	} else {
+		err = savePage(bodyBytes, savePath) //! TODO can be concurrent
+		if err == nil {
+			err = c.recordLongPath(u)
+		}
+	}
+	if pathConflict(err) {
+		// The links of the page are still followed
+		c.skipConflict(urlStr, err)
+		return nil
+	}
 	if err != nil {
 		fmt.Printf("failed to download/save URL %s: %v", urlStr, err)
 		return err
 	}
+	sum := sha256.Sum256(bodyBytes)
+	rec.Hash = hex.EncodeToString(sum[:])
+	rec.Size = int64(len(bodyBytes))
+	rec.SavePath = savePath
+	c.savedBytes += rec.Size
+	if err := c.recordSum(savePath, rec.Hash); err != nil {
+		return err
+	}
 
-	// Page visited
-	state[urlStr] = true
-	// Save the new state
-	saveState(state, stateFile)
+	return c.writeMeta(PageMeta{
+		URL:        urlStr,
+		Referrer:   item.Referrer,
+		Status:     resp.StatusCode,
+		Protocol:   resp.Proto,
+		SavePath:   savePath,
+		FetchedAt:  time.Now(),
+		Redirects:  redirects,
+		Alternates: alternates,
+		Wayback:    resp.Header.Get(waybackHeader),
+	})
+}
 
+// Queue the links of the page fetched from u. Pagination links are
+// crawled first, up to MaxPaginationDepth pages in a row. Every link
+// of a local file is crawled, its hosts becoming the scope.
+func (c *Crawler) queueLinks(doc *html.Node, u *url.URL, page queueItem) {
+	urlStr := u.String()
+	seed := u.Scheme == "file"
+	relLinks := relPaginationLinks(doc)
+	links := append(extractLinks(doc), relLinks...)
+	if c.HeuristicLinks {
+		links = append(links, heuristicLinks(doc)...)
+	}
 	// Filter valid URLs and download/save their content
 	for _, link := range links {
-		u, err := url.Parse(link)
+		link, ok := c.filterLink(link)
+		if !ok {
+			continue
+		}
+		ref, err := url.Parse(link)
 		if err != nil {
 			fmt.Printf("failed to parse URL %s: %v", link, err)
 			continue
 		}
-		if u.Host != "" && !strings.HasPrefix(urlStr, startURL) {
+		// Relative links are resolved against the page
+		target := u.ResolveReference(ref)
+		if !c.fetchable(target, u) {
+			continue
+		}
+		if seed && target.Scheme != "file" {
+			c.addSeedHost(target)
+			c.normalize(target)
+			c.enqueue(queueItem{URL: target.String(), Referrer: urlStr, Depth: page.Depth + 1})
+			continue
+		}
+		if !c.inScope(target) {
+			c.progress.link("out-of-scope")
 			fmt.Printf("Skip URLs with a different %s", link)
+			c.skipped(target.String(), "out of scope")
 			continue
 		}
-		if path.Ext(u.Path) != ".html" {
-			fmt.Printf("Skip non-HTML URLs %s %s\n", path.Ext(u.Path), link)
+		ext := path.Ext(target.Path)
+		download := c.OutlinksFile == "" && c.DownloadTypes[strings.ToLower(strings.TrimPrefix(ext, "."))]
+		paginated := !download && (slices.Contains(relLinks, link) || isPaginationURL(target))
+		if ext != ".html" && !download && !paginated {
+			fmt.Printf("Skip non-HTML URLs %s %s\n", ext, link)
+			c.skipped(target.String(), "not HTML")
 			continue
 		}
-		if _, ok := state[link]; !ok {
-			err := processPage(link, state, startURL, destDir, stateFile)
-			if err != nil {
-				return err
+		item := queueItem{Referrer: urlStr, Asset: download, Depth: page.Depth + 1}
+		if paginated {
+			item.Pagination, item.Priority = page.Pagination+1, true
+			if c.MaxPaginationDepth > 0 && item.Pagination > c.MaxPaginationDepth {
+				fmt.Printf("Skip %s, pagination deeper than %d\n", link, c.MaxPaginationDepth)
+				c.skipped(target.String(), "pagination too deep")
+				continue
 			}
 		}
+		c.normalize(target)
+		item.URL = target.String()
+		c.enqueue(item)
 	}
+}
+
+// A page that timed out is skipped and left unvisited, so a later
+// crawl finding it tries it again; a canceled crawl stops, the page
+// kept in the saved frontier
+func pageCanceled(crawlCtx context.Context, urlStr string) error {
+	if err := crawlCtx.Err(); err != nil {
+		return err
+	}
+	fmt.Printf("Timeout getting %s, skipped\n", urlStr)
 	return nil
 }
 
+// Write the page to a temporary file moved in place, so a page
+// crawled again replaces its old file and a crash never leaves it
+// half written
 func savePage(data []byte, savePath string) error {
 	fmt.Print(savePath)
 	path := filepath.Dir(savePath)
 	os.MkdirAll(path, os.ModePerm)
-	// Check if file exists
-	if _, err := os.Stat(savePath); os.IsNotExist(err) {
-		// File does not exist, create it
-		file, err := os.Create(savePath)
-		if err != nil {
-			fmt.Println("Error creating file:", err)
-			return err
+	tmp := savePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		fmt.Println("Error writing to file:", err)
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, savePath)
+}
+
+// Flag that can be repeated
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// Parse host:ip pairs
+func parseResolve(values []string) (map[string]string, error) {
+	resolve := make(map[string]string)
+	for _, v := range values {
+		host, ip, ok := strings.Cut(v, ":")
+		if !ok || host == "" || ip == "" {
+			return nil, fmt.Errorf("invalid -resolve %s, expected host:ip", v)
+		}
+		resolve[host] = ip
+	}
+	return resolve, nil
+}
+
+// Parse a size like 512K, 100M or 10G
+func parseSize(size string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(size))
+	multiplier := int64(1)
+	for i, unit := range []string{"K", "M", "G", "T"} {
+		if strings.HasSuffix(value, unit) || strings.HasSuffix(value, unit+"B") {
+			value = strings.TrimSuffix(strings.TrimSuffix(value, "B"), unit)
+			multiplier = 1 << (10 * (i + 1))
+			break
 		}
-		defer file.Close()
-		_, err = file.Write(data)
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %s", size)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// Parse a comma separated list of file extensions
+func parseTypes(value string) map[string]bool {
+	types := make(map[string]bool)
+	for _, t := range strings.Split(value, ",") {
+		t = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(t), "."))
+		if t != "" {
+			types[t] = true
+		}
+	}
+	return types
+}
+
+// Options of a crawl run that are not part of the Crawler
+type runOptions struct {
+	CrawlTimeout time.Duration
+	TUI          bool
+	// "text" or "ndjson", streaming the fetched pages to stdout
+	Output       string
+	PprofAddr    string
+	OTelEndpoint string
+}
+
+// Build a crawler from the command line flags
+func parseCrawlFlags(fs *flag.FlagSet, args []string) (*Crawler, runOptions, error) {
+	var opts runOptions
+	startURL := fs.String("start", "", "Starting URL")
+	destDir := fs.String("dir", "", "Destination directory")
+	stateFile := fs.String("state", "state.json", "State file")
+	stateTTL := fs.Duration("state-ttl", 0, "Crawl again the URLs fetched longer ago than this (0 to never)")
+	activeHoursFlag := fs.String("active-hours", "", "Daily window the crawl runs in, paused outside it, e.g. \"22:00-06:00 Europe/Rome\"")
+	checkpointEvery := fs.Duration("checkpoint-every", 0, "Interval between checkpoints of the crawl, e.g. 10m (0 for none)")
+	restoreCheckpoint := fs.Int("restore-checkpoint", 0, "Roll the crawl back to this checkpoint before starting")
+	sendReferer := fs.Bool("referer", false, "Send the linking page as Referer header")
+	visitedMode := fs.String("visited", "map", "Visited set: map, hash or bloom (confirmed on disk)")
+	expectedURLs := fs.Int("expected-urls", 10000000, "Expected number of URLs for the bloom filter")
+	bloomFPRate := fs.Float64("bloom-fp", 0.001, "False positive rate of the bloom filter")
+	cacheDir := fs.String("cache", "", "Directory of the HTTP cache (disabled if empty)")
+	dnsServer := fs.String("dns", "", "DNS server to use, e.g. 1.1.1.1:53")
+	dnsTTL := fs.Duration("dns-ttl", 5*time.Minute, "How long DNS answers are cached")
+	preferIP := fs.String("prefer-ip", "", "Preferred IP version: ipv4 or ipv6")
+	recordDir := fs.String("record", "", "Directory where the responses are recorded")
+	replayDir := fs.String("replay", "", "Directory of recorded responses to crawl instead of the network")
+	rotateHeaders := fs.String("rotate-headers", "", "JSON file of browser header profiles (User-Agent, Accept, ...) sent with the requests, or builtin")
+	rotateBy := fs.String("rotate-by", "request", "Pick a header profile for every request or host")
+	sign := fs.String("sign", "", "Sign the requests: hmac:key=secret[,header=X-Signature] or aws:region=...,service=...")
+	httpVersion := fs.String("http-version", "auto", "HTTP version: auto, 1.1, 2 or 3")
+	assets := fs.Bool("assets", false, "Download images, scripts and stylesheets")
+	srcset := fs.String("srcset", "largest", "srcset candidates to download: all or largest")
+	offsiteRedirects := fs.Bool("offsite-redirects", true, "Follow redirects leaving the host of the start URL")
+	upgradeHTTPS := fs.Bool("upgrade-https", false, "Rewrite http:// links to https://")
+	pageTimeout := fs.Duration("page-timeout", time.Minute, "Timeout of each page (0 for none)")
+	crawlTimeout := fs.Duration("crawl-timeout", 0, "Timeout of the whole crawl (0 for none)")
+	downloadTypes := fs.String("download-types", "", "Extensions of linked files to download, e.g. pdf,zip,mp4")
+	maxFileSize := fs.String("max-file-size", "0", "Maximum size of a downloaded file, e.g. 100M (0 for no limit)")
+	maxTotalSize := fs.String("max-total-size", "0", "Stop when the saved files reach this size, e.g. 10G (0 for no limit)")
+	minFreeSpace := fs.String("min-free-space", "0", "Pause while the free disk space is below this (0 to not check)")
+	languages := fs.String("languages", "", "Languages of the pages to save and follow, e.g. en,it")
+	matchContent := fs.String("match-content", "", "Regexp the page body must match")
+	excludeContent := fs.String("exclude-content", "", "Regexp the page body must not match")
+	contentFilter := fs.String("content-filter", "save", "What the content regexps restrict: save, follow or both")
+	budget := fs.String("budget", "", "Pages per domain, e.g. example.com=1000,blog.example.com=200")
+	wayback := fs.Bool("wayback", false, "Save the Wayback Machine snapshot of the pages answering 404 or 410")
+	headersOnly := fs.Bool("headers-only", false, "Write the response headers to headers.csv instead of saving the pages")
+	save := fs.String("save", "raw", "Pages saved as received (raw) or re-serialized from the parsed tree (dom)")
+	convertLinks := fs.Bool("convert-links", false, "With -save dom, point the links to the URLs crawled to the local copies, the others absolute")
+	transform := fs.String("transform", "", "Transformations of the saved pages: strip-js, strip-pixels, minify, prettify")
+	heuristicLinks := fs.Bool("heuristic-links", false, "Follow the URLs opened by onclick handlers, e.g. location.href='...'")
+	maxPaginationDepth := fs.Int("max-pagination-depth", 0, "Pagination pages followed in a row (0 for no limit)")
+	followHreflang := fs.Bool("follow-hreflang", false, "Crawl the hreflang alternates of the pages in the -languages selected")
+	nearDuplicates := fs.String("near-duplicates", "", "Near duplicate pages: flag or skip (not checked if empty)")
+	linkGraph := fs.Bool("link-graph", false, "Write every link with its anchor text, rel and heading to links.jsonl")
+	outlinks := fs.String("outlinks", "", "Save nothing, write the outlinks of the site to this file (.csv or .jsonl)")
+	seoReport := fs.Bool("seo-report", false, "Write the SEO data of the pages to seo.jsonl and a report to seo-report.txt")
+	accept := fs.String("accept", "", "Patterns of the files to save, e.g. \"*.html,*.pdf\"")
+	allowDomains := fs.String("allow-domains", "", "Other domains to crawl, e.g. example.org,*.example.org")
+	queueBackend := fs.String("queue", "memory", "Queue of the URLs to crawl: memory, disk[:file] or nats://host:port/stream")
+	shardStateFlag := fs.Bool("shard-state", false, "Keep the state of every host in its own file, state.<host>.json")
+	reject := fs.String("reject", "", "Patterns of the files to skip, e.g. \"*calendar*,*.gif\"")
+	output := fs.String("output", "text", "Output: text, or ndjson streaming a JSON line per fetched page to stdout, the log going to stderr")
+	tui := fs.Bool("tui", false, "Show a terminal dashboard")
+	pprofAddr := fs.String("pprof", "", "Address serving pprof and /debug/crawler, e.g. :6060")
+	otelEndpoint := fs.String("otel-endpoint", "", "OTLP/HTTP collector receiving the traces, e.g. localhost:4318")
+	store := fs.String("store", "tree", "Output store: tree or cas")
+	maxPathLength := fs.Int("max-path-length", 250, "Longest path of a saved file, longer ones are shortened with a hash (0 for no limit)")
+	naming := fs.String("naming", "tree", "File naming: tree, flat or hash")
+	query := fs.String("query", "keep", "Query strings: keep, strip or whitelist=a,b")
+	delay := fs.Duration("delay", 0, "Delay between requests to the same host")
+	jitter := fs.Float64("jitter", 0, "Random variation of the delay, as a fraction of it (e.g. 0.3)")
+	adaptiveDelay := fs.Bool("adaptive-delay", false, "Slow down hosts answering 429/503 or getting slower")
+	maxRetries := fs.Int("max-retries", 5, "Max retries of a URL answered with 429/503 and Retry-After")
+	breakerWindow := fs.Int("breaker-window", 0, "Requests per host the failure rate is computed on (0 disables the circuit breaker)")
+	breakerRate := fs.Float64("breaker-rate", 0.5, "Failure rate pausing a host")
+	breakerCooldown := fs.Duration("breaker-cooldown", time.Minute, "Pause of a failing host, doubled while it keeps failing")
+	var resolveFlags, rewriteFlags, statusFlags listFlag
+	fs.Var(&statusFlags, "on", "Action for a status code or class: code=skip|save|retry[:N]|requeue-later|abort, e.g. 404=skip (repeatable)")
+	fs.Var(&rewriteFlags, "rewrite", "Rewrite rule for discovered URLs, s#regexp#replacement#[g] (repeatable)")
+	fs.Var(&resolveFlags, "resolve", "Map a host to a fixed IP, host:ip (repeatable)")
+	if err := fs.Parse(args); err != nil {
+		return nil, opts, err
+	}
+
+	resolve, err := parseResolve(resolveFlags)
+	if err != nil {
+		return nil, opts, err
+	}
+	queryPolicy, err := parseQueryPolicy(*query)
+	if err != nil {
+		return nil, opts, err
+	}
+	maxSize, err := parseSize(*maxFileSize)
+	if err != nil {
+		return nil, opts, err
+	}
+	totalSize, err := parseSize(*maxTotalSize)
+	if err != nil {
+		return nil, opts, err
+	}
+	minFree, err := parseSize(*minFreeSpace)
+	if err != nil {
+		return nil, opts, err
+	}
+	budgets, err := parseBudgets(*budget)
+	if err != nil {
+		return nil, opts, err
+	}
+	acceptGlobs, err := parseGlobs(*accept)
+	if err != nil {
+		return nil, opts, err
+	}
+	rejectGlobs, err := parseGlobs(*reject)
+	if err != nil {
+		return nil, opts, err
+	}
+	domains, err := parseAllowDomains(*allowDomains)
+	if err != nil {
+		return nil, opts, err
+	}
+	transforms, err := parseTransforms(*transform)
+	if err != nil {
+		return nil, opts, err
+	}
+	signer, err := parseSigner(*sign)
+	if err != nil {
+		return nil, opts, err
+	}
+	activeHours, err := parseActiveHours(*activeHoursFlag)
+	if err != nil {
+		return nil, opts, err
+	}
+	profiles, err := loadHeaderProfiles(*rotateHeaders)
+	if err != nil {
+		return nil, opts, err
+	}
+	if *rotateBy != "request" && *rotateBy != "host" {
+		return nil, opts, fmt.Errorf("invalid -rotate-by %s, expected request or host", *rotateBy)
+	}
+	statusPolicies, err := parseStatusPolicies(statusFlags)
+	if err != nil {
+		return nil, opts, err
+	}
+	var rewrites []rewriteRule
+	for _, expr := range rewriteFlags {
+		rule, err := parseRewriteRule(expr)
 		if err != nil {
-			fmt.Println("Error writing to file:", err)
-			return err
+			return nil, opts, err
 		}
-		return nil
-	} else {
-		return errors.New("File already exists")
+		rewrites = append(rewrites, rule)
 	}
+	var matchRe, excludeRe *regexp.Regexp
+	if *matchContent != "" {
+		if matchRe, err = regexp.Compile(*matchContent); err != nil {
+			return nil, opts, fmt.Errorf("invalid -match-content: %v", err)
+		}
+	}
+	if *excludeContent != "" {
+		if excludeRe, err = regexp.Compile(*excludeContent); err != nil {
+			return nil, opts, fmt.Errorf("invalid -exclude-content: %v", err)
+		}
+	}
+
+	if *nearDuplicates != "" && *nearDuplicates != "flag" && *nearDuplicates != "skip" {
+		return nil, opts, fmt.Errorf("invalid -near-duplicates %s, expected flag or skip", *nearDuplicates)
+	}
+	if *save != "raw" && *save != "dom" {
+		return nil, opts, fmt.Errorf("invalid -save %s, expected raw or dom", *save)
+	}
+	switch *naming {
+	case "tree", "flat", "hash":
+	default:
+		return nil, opts, fmt.Errorf("invalid -naming %s, expected tree, flat or hash", *naming)
+	}
+	if *store != "tree" && *store != "cas" {
+		return nil, opts, fmt.Errorf("invalid -store %s, expected tree or cas", *store)
+	}
+	if *srcset != "all" && *srcset != "largest" {
+		return nil, opts, fmt.Errorf("invalid -srcset %s, expected all or largest", *srcset)
+	}
+	if *preferIP != "" && *preferIP != "ipv4" && *preferIP != "ipv6" {
+		return nil, opts, fmt.Errorf("invalid -prefer-ip %s, expected ipv4 or ipv6", *preferIP)
+	}
+	switch *contentFilter {
+	case "save", "follow", "both":
+	default:
+		return nil, opts, fmt.Errorf("invalid -content-filter %s, expected save, follow or both", *contentFilter)
+	}
+	if *recordDir != "" && *replayDir != "" {
+		return nil, opts, fmt.Errorf("-record and -replay exclude each other")
+	}
+	if *breakerRate <= 0 || *breakerRate > 1 {
+		return nil, opts, fmt.Errorf("invalid -breaker-rate, expected a value above 0 and up to 1")
+	}
+	switch *visitedMode {
+	case "map", "hash", "bloom":
+	default:
+		return nil, opts, fmt.Errorf("invalid -visited %s, expected map, hash or bloom", *visitedMode)
+	}
+	if *bloomFPRate <= 0 || *bloomFPRate >= 1 {
+		return nil, opts, fmt.Errorf("invalid -bloom-fp, expected a value between 0 and 1")
+	}
+	if *output != "text" && *output != "ndjson" {
+		return nil, opts, fmt.Errorf("invalid -output %s, expected text or ndjson", *output)
+	}
+	if *jitter < 0 || *jitter > 1 {
+		return nil, opts, fmt.Errorf("invalid -jitter, expected a value between 0 and 1")
+	}
+
+	c := &Crawler{
+		StartURL:           *startURL,
+		DestDir:            *destDir,
+		StateFile:          *stateFile,
+		StateTTL:           *stateTTL,
+		CheckpointEvery:    *checkpointEvery,
+		ActiveHours:        activeHours,
+		RestoreCheckpoint:  *restoreCheckpoint,
+		SendReferer:        *sendReferer,
+		VisitedMode:        *visitedMode,
+		ExpectedURLs:       *expectedURLs,
+		BloomFPRate:        *bloomFPRate,
+		CacheDir:           *cacheDir,
+		DNSServer:          *dnsServer,
+		DNSTTL:             *dnsTTL,
+		PreferIP:           *preferIP,
+		Resolve:            resolve,
+		RecordDir:          *recordDir,
+		ReplayDir:          *replayDir,
+		Signer:             signer,
+		HeaderProfiles:     profiles,
+		RotateByHost:       *rotateBy == "host",
+		HTTPVersion:        *httpVersion,
+		Delay:              *delay,
+		Jitter:             *jitter,
+		AdaptiveDelay:      *adaptiveDelay,
+		MaxRetries:         *maxRetries,
+		BreakerWindow:      *breakerWindow,
+		BreakerRate:        *breakerRate,
+		BreakerCooldown:    *breakerCooldown,
+		StatusPolicies:     statusPolicies,
+		Query:              queryPolicy,
+		Assets:             *assets,
+		Srcset:             *srcset,
+		Naming:             *naming,
+		MaxPathLength:      *maxPathLength,
+		Store:              *store,
+		OffsiteRedirects:   *offsiteRedirects,
+		UpgradeHTTPS:       *upgradeHTTPS,
+		PageTimeout:        *pageTimeout,
+		DownloadTypes:      parseTypes(*downloadTypes),
+		MaxFileSize:        maxSize,
+		MaxTotalSize:       totalSize,
+		MinFreeSpace:       minFree,
+		Languages:          parseLanguages(*languages),
+		MatchContent:       matchRe,
+		ExcludeContent:     excludeRe,
+		ContentFilter:      *contentFilter,
+		Budgets:            budgets,
+		Rewrites:           rewrites,
+		Wayback:            *wayback,
+		HeadersOnly:        *headersOnly,
+		Save:               *save,
+		ConvertLinks:       *convertLinks,
+		Transforms:         transforms,
+		HeuristicLinks:     *heuristicLinks,
+		MaxPaginationDepth: *maxPaginationDepth,
+		FollowHreflang:     *followHreflang,
+		NearDuplicates:     *nearDuplicates,
+		SEOReport:          *seoReport,
+		LinkGraph:          *linkGraph,
+		OutlinksFile:       *outlinks,
+		AllowDomains:       domains,
+		ShardState:         *shardStateFlag,
+		QueueBackend:       *queueBackend,
+		Accept:             acceptGlobs,
+		Reject:             rejectGlobs,
+	}
+	opts = runOptions{
+		CrawlTimeout: *crawlTimeout,
+		TUI:          *tui,
+		Output:       *output,
+		PprofAddr:    *pprofAddr,
+		OTelEndpoint: *otelEndpoint,
+	}
+	return c, opts, nil
 }
 
 func main() {
-	stateFile := "state.json"
-
-	startURL := flag.String("start", "", "Starting URL")
-	destDir := flag.String("dir", "", "Destination directory")
-	flag.Parse()
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "verify-local":
+			if err := verifyLocal(os.Args[2:]); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			return
+		case "state":
+			if err := runState(os.Args[2:]); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			return
+		case "serve-mirror":
+			if err := serveMirror(os.Args[2:]); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			return
+		case "daemon":
+			if err := runDaemon(os.Args[2:]); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
 
-	if len(*startURL) == 0 || len(*destDir) == 0 {
+	c, opts, err := parseCrawlFlags(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if c.StartURL == "" || c.DestDir == "" {
 		fmt.Print("use command -start <url> -dir <directory>\n")
 	}
+	if opts.Output == "ndjson" {
+		// Only the results on stdout, for jq and the like
+		c.Results = os.Stdout
+		os.Stdout = os.Stderr
+	}
 
-	state, err := crawl(*startURL, stateFile, *startURL, *destDir)
+	// Ctrl-C stops the crawl cleanly
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if opts.CrawlTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.CrawlTimeout)
+		defer cancel()
+	}
+	if opts.PprofAddr != "" {
+		c.serveDebug(opts.PprofAddr)
+	}
+	shutdown, err := startTracing(ctx, opts.OTelEndpoint)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer shutdown(context.Background())
+	var state State
+	run := func(ctx context.Context) error {
+		state, err = c.crawl(ctx, c.StartURL)
+		return err
+	}
+	if opts.TUI {
+		err = c.runTUI(ctx, run)
+	} else {
+		err = run(ctx)
+	}
 	if err != nil {
 		fmt.Println("Errore durante il crawling:", err)
 		return
@@ -183,4 +1349,10 @@ func main() {
 	for url := range state {
 		fmt.Println(url)
 	}
+	if c.compactVisited() {
+		fmt.Println("Other visited pages are listed in", visitedLogFile(c.StateFile))
+	}
+	c.Filtered.Print()
+	c.printHosts()
+	c.printFrontier()
 }
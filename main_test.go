@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// Site of linked pages, recording the paths requested
+func testSite(t *testing.T, pages map[string]string) (*httptest.Server, func() []string) {
+	var mu sync.Mutex
+	var requested []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		mu.Lock()
+		requested = append(requested, r.URL.Path)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		paths := slices.Clone(requested)
+		slices.Sort(paths)
+		return paths
+	}
+}
+
+func TestResumeFromState(t *testing.T) {
+	pages := map[string]string{
+		"/":       `<a href="a.html">a</a> <a href="b.html">b</a>`,
+		"/a.html": `<a href="c.html">c</a>`,
+		"/b.html": `b`,
+		"/c.html": `c`,
+		"/d.html": `d`,
+	}
+	tests := []struct {
+		name     string
+		visited  []string
+		frontier []string
+		want     []string
+	}{
+		{
+			name: "no state",
+			want: []string{"/", "/a.html", "/b.html", "/c.html"},
+		},
+		{
+			name:    "only the start page",
+			visited: []string{"/"},
+			want:    []string{"/", "/a.html", "/b.html", "/c.html"},
+		},
+		{
+			name:    "every page",
+			visited: []string{"/", "/a.html", "/b.html", "/c.html"},
+			want:    []string{"/"},
+		},
+		{
+			name:     "frontier left",
+			visited:  []string{"/", "/a.html", "/b.html"},
+			frontier: []string{"/c.html", "/d.html"},
+			want:     []string{"/", "/c.html", "/d.html"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, requested := testSite(t, pages)
+			dir := t.TempDir()
+			stateFile := filepath.Join(dir, "state.json")
+			if tt.visited != nil {
+				state := make(State)
+				for _, p := range tt.visited {
+					state[srv.URL+p] = PageRecord{Status: http.StatusOK}
+				}
+				if err := saveState(state, stateFile); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.frontier != nil {
+				var lines []byte
+				for _, p := range tt.frontier {
+					line, _ := json.Marshal(queueItem{URL: srv.URL + p, Depth: 1})
+					lines = append(append(lines, line...), '\n')
+				}
+				if err := os.WriteFile(frontierFile(stateFile), lines, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			fs := flag.NewFlagSet("crawl", flag.ContinueOnError)
+			c, _, err := parseCrawlFlags(fs, []string{"-start", srv.URL + "/", "-dir", filepath.Join(dir, "out"), "-state", stateFile})
+			if err != nil {
+				t.Fatal(err)
+			}
+			state, err := c.crawl(context.Background(), c.StartURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := requested(); !slices.Equal(got, tt.want) {
+				t.Errorf("requested %v, want %v", got, tt.want)
+			}
+			for p := range pages {
+				if _, ok := state[srv.URL+p]; !ok && (slices.Contains(tt.want, p) || slices.Contains(tt.visited, p)) {
+					t.Errorf("%s not in the state", p)
+				}
+			}
+			if _, err := os.Stat(frontierFile(stateFile)); !os.IsNotExist(err) {
+				t.Errorf("frontier file left: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Metadata of a saved page, appended to metadata.jsonl in the
+// destination directory
+type PageMeta struct {
+	URL       string    `json:"url"`
+	Referrer  string    `json:"referrer,omitempty"`
+	Status    int       `json:"status"`
+	Protocol  string    `json:"protocol"`
+	SavePath  string    `json:"save_path"`
+	FetchedAt time.Time `json:"fetched_at"`
+	// Redirects followed to reach URL, starting from the requested one
+	Redirects []RedirectHop `json:"redirects,omitempty"`
+	// Alternate versions of the page by hreflang
+	Alternates map[string]string `json:"alternates,omitempty"`
+	// Wayback Machine snapshot saved because the page was gone
+	Wayback string `json:"wayback,omitempty"`
+}
+
+const metaFileName = "metadata.jsonl"
+
+func (c *Crawler) writeMeta(meta PageMeta) error {
+	if c.metaFile == nil {
+		os.MkdirAll(c.DestDir, os.ModePerm)
+		file, err := os.OpenFile(filepath.Join(c.DestDir, metaFileName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		c.metaFile = file
+	}
+	return json.NewEncoder(c.metaFile).Encode(meta)
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unicode/utf8"
+)
+
+// Longest file name kept as it is, most filesystems allow 255 bytes
+const maxSegmentLength = 200
+
+// Device names reserved on Windows, whatever the extension
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// Path where the URL is saved. Naming is "tree" (the URL path),
+// "flat" (one file per host) or "hash" (SHA-256 of the URL).
+func (c *Crawler) localPath(u *url.URL) string {
+	savePath, _ := c.mappedPath(u)
+	return savePath
+}
+
+// Path where the URL is saved and, if it had to be shortened, the
+// path it would have had. The segments come from the escaped path, so
+// an encoded slash as in /a%2Fb stays in its segment.
+func (c *Crawler) mappedPath(u *url.URL) (string, string) {
+	var dir []string
+	for _, s := range strings.Split(u.EscapedPath(), "/") {
+		if s != "" {
+			dir = append(dir, unescapeSegment(s))
+		}
+	}
+	file := "index.html"
+	if n := len(dir); n > 0 && !strings.HasSuffix(u.EscapedPath(), "/") {
+		file = dir[n-1]
+		dir = dir[:n-1]
+	}
+	ext := path.Ext(file)
+	if ext == "" && c.Naming != "flat" && c.Naming != "hash" {
+		// A page like /docs is saved as docs/index.html, so that
+		// /docs/intro.html can be saved next to it
+		dir = append(dir, file)
+		file = "index.html"
+	}
+	file = queryFileName(file, u.RawQuery)
+
+	var segments []string
+	switch c.Naming {
+	case "flat":
+		var parts []string
+		for _, s := range append(dir, file) {
+			// Escaping the percent signs again, the escaped slash
+			// joining the parts can't appear in them
+			parts = append(parts, strings.ReplaceAll(sanitizeSegment(s), "%", "%25"))
+		}
+		segments = []string{strings.Join(parts, "%2F")}
+	case "hash":
+		sum := sha256.Sum256([]byte(u.String()))
+		if ext != "" {
+			ext = sanitizeSegment(ext)
+		}
+		if len(ext) > 10 {
+			ext = ""
+		}
+		segments = []string{hex.EncodeToString(sum[:16]) + ext}
+	default:
+		for _, s := range append(dir, file) {
+			segments = append(segments, sanitizeSegment(s))
+		}
+	}
+
+	host := unicodeHost(u.Hostname())
+	if host == "" {
+		// Local files
+		host = u.Scheme
+	}
+	rel := c.claimPath(path.Join(append([]string{sanitizeSegment(host)}, segments...)...))
+	short := c.shortenPath(rel)
+	if short == rel {
+		return path.Join(c.DestDir, rel), ""
+	}
+	return path.Join(c.DestDir, short), path.Join(c.DestDir, rel)
+}
+
+// Decode a segment of the escaped path, keeping it as it is when the
+// escaping is invalid
+func unescapeSegment(s string) string {
+	if decoded, err := url.PathUnescape(s); err == nil {
+		return decoded
+	}
+	return s
+}
+
+// The path of a URL is taken by a file where a directory is needed, or
+// the other way around, e.g. /v1.2 saved before /v1.2/intro.html
+func pathConflict(err error) bool {
+	return errors.Is(err, syscall.ENOTDIR) || errors.Is(err, syscall.EISDIR)
+}
+
+func (c *Crawler) skipConflict(urlStr string, err error) {
+	fmt.Printf("Not saving %s, path conflict: %v\n", urlStr, err)
+	c.skipped(urlStr, "path conflict")
+}
+
+// Keep the absolute path within MaxPathLength: the leading
+// directories that fit are kept, the rest of the path is replaced
+// with its hash and the extension
+func (c *Crawler) shortenPath(rel string) string {
+	if c.MaxPathLength <= 0 {
+		return rel
+	}
+	base := c.DestDir
+	if abs, err := filepath.Abs(c.DestDir); err == nil {
+		base = abs
+	}
+	budget := c.MaxPathLength - len(base) - 1
+	if len(rel) <= budget {
+		return rel
+	}
+	sum := sha256.Sum256([]byte(rel))
+	ext := path.Ext(rel)
+	if len(ext) > 16 || strings.Contains(ext, "/") {
+		ext = ""
+	}
+	tail := "~" + hex.EncodeToString(sum[:8]) + ext
+	segments := strings.Split(rel, "/")
+	var kept []string
+	length := 0
+	for _, s := range segments[:len(segments)-1] {
+		if length+len(s)+1+len(tail) > budget {
+			break
+		}
+		kept = append(kept, s)
+		length += len(s) + 1
+	}
+	return path.Join(append(kept, tail)...)
+}
+
+// Make a path segment valid on every OS: characters illegal on Windows,
+// control characters, invalid UTF-8 and "%" are percent-encoded (so an
+// encoded character can't collide with a literal one), reserved device
+// names are prefixed and long names are truncated with a hash
+func sanitizeSegment(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		if r == utf8.RuneError && !strings.HasPrefix(s[i:], string(utf8.RuneError)) {
+			fmt.Fprintf(&b, "%%%02X", s[i])
+		} else if r == '%' || r < 0x20 || r == 0x7f || strings.ContainsRune(`<>:"/\|?*`, r) {
+			fmt.Fprintf(&b, "%%%02X", r)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	s = b.String()
+
+	// Windows drops trailing dots and spaces
+	if strings.HasSuffix(s, ".") || strings.HasSuffix(s, " ") {
+		s = s[:len(s)-1] + fmt.Sprintf("%%%02X", s[len(s)-1])
+	}
+	if s == "" || s == "." {
+		s = "%2E"
+	}
+	base, _, _ := strings.Cut(s, ".")
+	if reservedNames[strings.ToUpper(base)] {
+		s = "_" + s
+	}
+	if len(s) > maxSegmentLength {
+		s = truncateSegment(s, maxSegmentLength)
+	}
+	return s
+}
+
+// Keep the head of the name and the extension, replacing the rest
+// with its hash
+func truncateSegment(s string, max int) string {
+	sum := sha256.Sum256([]byte(s))
+	suffix := "~" + hex.EncodeToString(sum[:8])
+	ext := path.Ext(s)
+	if len(ext) > 16 {
+		ext = ""
+	}
+	head := s[:max-len(suffix)-len(ext)]
+	// Don't cut a percent-encoded character or a UTF-8 sequence
+	for !utf8.ValidString(head) {
+		head = head[:len(head)-1]
+	}
+	if i := strings.LastIndex(head, "%"); i >= 0 && i > len(head)-3 {
+		head = head[:i]
+	}
+	return head + suffix + ext
+}
+
+// Paths differing only by case collide on case-insensitive
+// filesystems: the first one keeps its name, the others get a suffix.
+// The files saved by earlier crawls are listed the first time their
+// directory is seen, so the names stay the same across crawls.
+func (c *Crawler) claimPath(rel string) string {
+	if c.caseNames == nil {
+		c.caseNames = make(map[string]string)
+		c.caseDirs = make(map[string]bool)
+	}
+	if dir := path.Dir(rel); !c.caseDirs[dir] {
+		c.caseDirs[dir] = true
+		entries, _ := os.ReadDir(filepath.Join(c.DestDir, filepath.FromSlash(dir)))
+		for _, entry := range entries {
+			if name := path.Join(dir, entry.Name()); !entry.IsDir() {
+				c.caseNames[strings.ToLower(name)] = name
+			}
+		}
+	}
+	key := strings.ToLower(rel)
+	owner, ok := c.caseNames[key]
+	if !ok || owner == rel {
+		c.caseNames[key] = rel
+		return rel
+	}
+	sum := sha256.Sum256([]byte(rel))
+	dir, file := path.Split(rel)
+	ext := path.Ext(file)
+	alt := path.Join(dir, strings.TrimSuffix(file, ext)+"~"+hex.EncodeToString(sum[:4])+ext)
+	c.caseNames[strings.ToLower(alt)] = alt
+	return alt
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/url"
+	"path"
+	"testing"
+)
+
+func TestMappedPath(t *testing.T) {
+	tests := []struct {
+		naming string
+		url    string
+		want   string
+	}{
+		{"tree", "http://example.com/", "example.com/index.html"},
+		{"tree", "http://example.com/a.html", "example.com/a.html"},
+		{"tree", "http://example.com/docs", "example.com/docs/index.html"},
+		{"tree", "http://example.com/docs/", "example.com/docs/index.html"},
+		{"tree", "http://example.com/docs/intro.html", "example.com/docs/intro.html"},
+		{"tree", "http://example.com/a%2Fb.html", "example.com/a%2Fb.html"},
+		{"tree", "http://example.com/a%20b.html", "example.com/a b.html"},
+		{"tree", "http://example.com/a%25b.html", "example.com/a%25b.html"},
+		{"tree", "http://example.com/list.html?page=2", "example.com/list@page=2.html"},
+		{"tree", "http://example.com/con.html", "example.com/_con.html"},
+		{"tree", "http://example.com:8080/a.html", "example.com/a.html"},
+		{"flat", "http://example.com/docs/intro.html", "example.com/docs%2Fintro.html"},
+		{"flat", "http://example.com/docs", "example.com/docs"},
+		{"flat", "http://example.com/a%2Fb.html", "example.com/a%252Fb.html"},
+		{"hash", "http://example.com/docs/intro.html", "example.com/a74da6e39b0f76e410ea4dd1200b92a2.html"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.naming+" "+tt.url, func(t *testing.T) {
+			dir := t.TempDir()
+			c := &Crawler{DestDir: dir, Naming: tt.naming}
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, long := c.mappedPath(u)
+			if want := path.Join(dir, tt.want); got != want {
+				t.Errorf("got %s, want %s", got, want)
+			}
+			if long != "" {
+				t.Errorf("path shortened from %s", long)
+			}
+		})
+	}
+}
+
+func TestMappedPathCase(t *testing.T) {
+	dir := t.TempDir()
+	c := &Crawler{DestDir: dir}
+	upper, _ := c.mappedPath(&url.URL{Scheme: "http", Host: "example.com", Path: "/Up.html"})
+	lower, _ := c.mappedPath(&url.URL{Scheme: "http", Host: "example.com", Path: "/up.html"})
+	if upper != path.Join(dir, "example.com/Up.html") {
+		t.Errorf("first path %s renamed", upper)
+	}
+	if lower == upper || path.Dir(lower) != path.Dir(upper) {
+		t.Errorf("got %s for /up.html next to %s", lower, upper)
+	}
+	again, _ := c.mappedPath(&url.URL{Scheme: "http", Host: "example.com", Path: "/up.html"})
+	if again != lower {
+		t.Errorf("got %s the second time, %s the first", again, lower)
+	}
+}
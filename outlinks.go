@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Link to a page out of scope, written in outlinks mode
+type Outlink struct {
+	URL    string `json:"url"`
+	Source string `json:"source"`
+	Text   string `json:"text,omitempty"`
+	Rel    string `json:"rel,omitempty"`
+}
+
+var outlinksColumns = []string{"url", "source", "text", "rel"}
+
+// Anchors of the page leading out of scope
+func (c *Crawler) outlinks(doc *html.Node, u *url.URL) []Outlink {
+	var links []Outlink
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && (n.Data == "a" || n.Data == "area") {
+			link, _, _ := strings.Cut(strings.TrimSpace(getAttr(n, "href")), "#")
+			if link != "" {
+				if ref, err := url.Parse(link); err == nil {
+					target := u.ResolveReference(ref)
+					if (target.Scheme == "http" || target.Scheme == "https") && !c.inScope(target) {
+						links = append(links, Outlink{
+							URL:    target.String(),
+							Source: u.String(),
+							Text:   anchorText(n),
+							Rel:    getAttr(n, "rel"),
+						})
+					}
+				}
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(doc)
+	return links
+}
+
+// Text of the anchor, or the alt text of its images
+func anchorText(n *html.Node) string {
+	if text := nodeText(n); text != "" {
+		return text
+	}
+	if n.Data == "area" {
+		return getAttr(n, "alt")
+	}
+	var alts []string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "img" {
+			if alt := strings.TrimSpace(getAttr(n, "alt")); alt != "" {
+				alts = append(alts, alt)
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(n)
+	return strings.Join(alts, " ")
+}
+
+// Append the outlinks of the page not written yet to OutlinksFile,
+// CSV if its extension is .csv, JSON lines otherwise
+func (c *Crawler) writeOutlinks(doc *html.Node, u *url.URL) error {
+	isCSV := strings.EqualFold(filepath.Ext(c.OutlinksFile), ".csv")
+	if c.outlinksFile == nil {
+		os.MkdirAll(filepath.Dir(c.OutlinksFile), os.ModePerm)
+		file, err := os.OpenFile(c.OutlinksFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		c.outlinksFile = file
+		c.outlinksSeen = outlinksWritten(c.OutlinksFile, isCSV)
+	}
+	w := csv.NewWriter(c.outlinksFile)
+	if info, err := c.outlinksFile.Stat(); isCSV && err == nil && info.Size() == 0 {
+		w.Write(outlinksColumns)
+	}
+	encoder := json.NewEncoder(c.outlinksFile)
+	for _, link := range c.outlinks(doc, u) {
+		key := link.Source + " " + link.URL
+		if c.outlinksSeen[key] {
+			continue
+		}
+		c.outlinksSeen[key] = true
+		if !isCSV {
+			if err := encoder.Encode(link); err != nil {
+				return err
+			}
+			continue
+		}
+		w.Write([]string{link.URL, link.Source, link.Text, link.Rel})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// Source and URL keys of the outlinks already in the file,
+// so that a resumed crawl doesn't write them again
+func outlinksWritten(name string, isCSV bool) map[string]bool {
+	seen := make(map[string]bool)
+	file, err := os.Open(name)
+	if err != nil {
+		return seen
+	}
+	defer file.Close()
+	if isCSV {
+		r := csv.NewReader(file)
+		r.FieldsPerRecord = -1
+		for {
+			row, err := r.Read()
+			if _, invalid := err.(*csv.ParseError); invalid {
+				continue
+			} else if err != nil {
+				break
+			}
+			if len(row) >= 2 && !slices.Equal(row, outlinksColumns) {
+				seen[row[1]+" "+row[0]] = true
+			}
+		}
+		return seen
+	}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		var link Outlink
+		if json.Unmarshal(scanner.Bytes(), &link) == nil {
+			seen[link.Source+" "+link.URL] = true
+		}
+	}
+	return seen
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Paths and query parameters of the usual pagination schemes:
+// /page/2/, ?page=2, ?p=2, ?paged=2
+var (
+	paginationPath   = regexp.MustCompile(`(?i)/page/\d+/?$`)
+	paginationParams = []string{"page", "p", "pg", "paged"}
+)
+
+// Links marked rel="next" or rel="prev", from <a> and <link>
+func relPaginationLinks(doc *html.Node) []string {
+	var links []string
+	var find func(*html.Node)
+	find = func(n *html.Node) {
+		if n.Type == html.ElementNode && (n.Data == "a" || n.Data == "link") {
+			rels := strings.Fields(strings.ToLower(getAttr(n, "rel")))
+			if slices.Contains(rels, "next") || slices.Contains(rels, "prev") || slices.Contains(rels, "previous") {
+				if href := getAttr(n, "href"); href != "" {
+					links = append(links, href)
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			find(c)
+		}
+	}
+	find(doc)
+	return links
+}
+
+func isPaginationURL(u *url.URL) bool {
+	if paginationPath.MatchString(u.Path) {
+		return true
+	}
+	query := u.Query()
+	for _, param := range paginationParams {
+		if _, err := strconv.Atoi(query.Get(param)); err == nil {
+			return true
+		}
+	}
+	return false
+}
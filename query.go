@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// How query strings take part in URL identity: "keep" them,
+// "strip" them, or keep only the whitelisted parameters
+type QueryPolicy struct {
+	Mode    string
+	Allowed map[string]bool
+}
+
+// Parse keep, strip or whitelist=a,b
+func parseQueryPolicy(value string) (QueryPolicy, error) {
+	mode, params, _ := strings.Cut(value, "=")
+	switch mode {
+	case "", "keep":
+		return QueryPolicy{Mode: "keep"}, nil
+	case "strip":
+		return QueryPolicy{Mode: "strip"}, nil
+	case "whitelist":
+		allowed := make(map[string]bool)
+		for _, p := range strings.Split(params, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				allowed[p] = true
+			}
+		}
+		return QueryPolicy{Mode: "whitelist", Allowed: allowed}, nil
+	}
+	return QueryPolicy{}, fmt.Errorf("invalid -query %s, expected keep, strip or whitelist=a,b", value)
+}
+
+// Rewrite the query of the URL according to the policy
+func (p QueryPolicy) apply(u *url.URL) {
+	switch p.Mode {
+	case "strip":
+		u.RawQuery = ""
+		u.ForceQuery = false
+	case "whitelist":
+		values := u.Query()
+		for k := range values {
+			if !p.Allowed[k] {
+				values.Del(k)
+			}
+		}
+		// Encode sorts the parameters, so their order doesn't matter
+		u.RawQuery = values.Encode()
+		u.ForceQuery = false
+	}
+}
+
+// Query as part of a file name: page.html?a=1 is saved as page@a=1.html
+func queryFileName(name string, rawQuery string) string {
+	if rawQuery == "" {
+		return name
+	}
+	ext := ""
+	if i := strings.LastIndex(name, "."); i > 0 {
+		name, ext = name[:i], name[i:]
+	}
+	return name + "@" + rawQuery + ext
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Queue of the URLs to crawl. Push and Pop cannot fail: a backend
+// that can records its first error, returned by Err.
+type Queue interface {
+	Len() int
+	// Priority URLs go after the other priority ones, before the rest
+	Push(item queueItem)
+	// Pop a URL whose host can be requested now if possible; it may
+	// return an empty item when the queue turned out to be empty
+	Pop(throttle *hostThrottle) queueItem
+	// Remove the URLs matching the function, returning how many
+	Drop(match func(queueItem) bool) int
+	// Number of queued URLs by host
+	HostLens() map[string]int
+	// Copy of the queued URLs, for the checkpoints
+	Items() []queueItem
+	Err() error
+	Close() error
+}
+
+// Queue of the -queue backend: memory (the default), disk, optionally
+// followed by the spill file, or a nats:// URL
+func newQueue(backend, stateFile string) (Queue, error) {
+	name, arg, _ := strings.Cut(backend, ":")
+	switch name {
+	case "", "memory":
+		return &frontier{}, nil
+	case "disk":
+		if arg == "" {
+			arg = stateFile + ".queue"
+		}
+		return newDiskQueue(arg, diskQueueWindow)
+	case "nats":
+		return newNATSQueue(backend)
+	}
+	return nil, fmt.Errorf("invalid -queue %s, expected memory, disk[:file] or nats://host:port/stream", backend)
+}
+
+// File of the URLs still queued when a crawl stopped, queued again
+// by the next crawl with the same state
+func frontierFile(stateFile string) string {
+	return stateFile + ".frontier"
+}
+
+// Save the pending URLs, one JSON item per line, removing the file
+// when there are none. A NATS stream keeps its URLs itself.
+func (c *Crawler) saveFrontier() error {
+	if strings.HasPrefix(c.QueueBackend, "nats") {
+		return nil
+	}
+	file := frontierFile(c.StateFile)
+	items := c.queue.Items()
+	if len(items) == 0 {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	tmp := file + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(out)
+	encoder := json.NewEncoder(w)
+	for _, item := range items {
+		if err := encoder.Encode(item); err != nil {
+			out.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// URLs saved by saveFrontier, none if there is no file
+func loadFrontier(file string) ([]queueItem, error) {
+	in, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	var items []queueItem
+	decoder := json.NewDecoder(in)
+	for {
+		var item queueItem
+		err := decoder.Decode(&item)
+		if err == io.EOF {
+			return items, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid frontier %s: %v", file, err)
+		}
+		items = append(items, item)
+	}
+}
+
+func (f *frontier) Items() []queueItem {
+	var items []queueItem
+	for _, fi := range f.ordered() {
+		items = append(items, fi.item)
+	}
+	return items
+}
+
+func (f *frontier) Err() error {
+	return nil
+}
+
+func (f *frontier) Close() error {
+	return nil
+}
+
+// URLs kept in memory by the disk queue
+const diskQueueWindow = 10000
+
+// Queue keeping up to window URLs in memory and the rest in a spill
+// file, read back in order as the memory empties. The file is only
+// scratch space, emptied at the start: a crawl is resumed from the
+// frontier saved with the state or a checkpoint.
+type diskQueue struct {
+	mem    *frontier
+	window int
+	path   string
+	writer *os.File
+	reader *bufio.Reader
+	file   *os.File
+	// URLs in the file and by host
+	spilled int
+	hosts   map[string]int
+	// Bytes of the file already read
+	offset int64
+	err    error
+}
+
+func newDiskQueue(path string, window int) (*diskQueue, error) {
+	os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	q := &diskQueue{mem: &frontier{}, window: window, path: path, hosts: make(map[string]int)}
+	if err := q.open(os.O_TRUNC); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func (q *diskQueue) open(flag int) error {
+	writer, err := os.OpenFile(q.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY|flag, 0644)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(q.path)
+	if err != nil {
+		writer.Close()
+		return err
+	}
+	q.writer, q.file, q.reader, q.offset = writer, file, bufio.NewReader(file), 0
+	return nil
+}
+
+func (q *diskQueue) fail(err error) {
+	if q.err == nil {
+		q.err = err
+	}
+}
+
+func (q *diskQueue) Len() int {
+	return q.mem.Len() + q.spilled
+}
+
+// Once URLs are spilled the next ones follow them, to keep the order
+func (q *diskQueue) Push(item queueItem) {
+	if item.Priority || (q.spilled == 0 && q.mem.Len() < q.window) {
+		q.mem.Push(item)
+		return
+	}
+	line, err := json.Marshal(item)
+	if err == nil {
+		_, err = q.writer.Write(append(line, '\n'))
+	}
+	if err != nil {
+		q.fail(fmt.Errorf("queue %s: %v", q.path, err))
+		return
+	}
+	q.spilled++
+	q.hosts[itemHost(item)]++
+}
+
+func (q *diskQueue) Pop(throttle *hostThrottle) queueItem {
+	if q.mem.Len() < q.window/2 {
+		q.refill()
+	}
+	if q.mem.Len() == 0 {
+		return queueItem{}
+	}
+	return q.mem.Pop(throttle)
+}
+
+// Move spilled URLs to the memory, emptying the file when all are read
+func (q *diskQueue) refill() {
+	for q.spilled > 0 && q.mem.Len() < q.window {
+		line, err := q.reader.ReadBytes('\n')
+		if err != nil {
+			q.fail(fmt.Errorf("queue %s: %v", q.path, err))
+			return
+		}
+		q.offset += int64(len(line))
+		var item queueItem
+		if err := json.Unmarshal(line, &item); err != nil {
+			q.fail(fmt.Errorf("queue %s: %v", q.path, err))
+			return
+		}
+		q.spilled--
+		q.hosts[itemHost(item)]--
+		q.mem.Push(item)
+	}
+	if q.spilled == 0 && q.offset > 0 {
+		if err := q.writer.Truncate(0); err != nil {
+			q.fail(err)
+			return
+		}
+		q.file.Seek(0, io.SeekStart)
+		q.reader.Reset(q.file)
+		q.offset = 0
+	}
+}
+
+// URLs spilled and not read yet
+func (q *diskQueue) spilledItems(fn func(queueItem) error) error {
+	file, err := os.Open(q.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := file.Seek(q.offset, io.SeekStart); err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(file)
+	for i := 0; i < q.spilled; i++ {
+		var item queueItem
+		if err := decoder.Decode(&item); err != nil {
+			return err
+		}
+		if err := fn(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The spilled URLs kept are written to a new file replacing the old one
+func (q *diskQueue) Drop(match func(queueItem) bool) int {
+	dropped := q.mem.Drop(match)
+	if q.spilled == 0 {
+		return dropped
+	}
+	tmp := q.path + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		q.fail(err)
+		return dropped
+	}
+	w := bufio.NewWriter(out)
+	encoder := json.NewEncoder(w)
+	kept := 0
+	hosts := make(map[string]int)
+	err = q.spilledItems(func(item queueItem) error {
+		if match(item) {
+			dropped++
+			return nil
+		}
+		kept++
+		hosts[itemHost(item)]++
+		return encoder.Encode(item)
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		q.writer.Close()
+		q.file.Close()
+		err = os.Rename(tmp, q.path)
+	}
+	if err == nil {
+		err = q.open(0)
+	}
+	if err != nil {
+		q.fail(fmt.Errorf("queue %s: %v", q.path, err))
+		return dropped
+	}
+	q.spilled, q.hosts = kept, hosts
+	return dropped
+}
+
+func (q *diskQueue) HostLens() map[string]int {
+	hosts := q.mem.HostLens()
+	for host, n := range q.hosts {
+		hosts[host] += n
+	}
+	return hosts
+}
+
+func (q *diskQueue) Items() []queueItem {
+	items := q.mem.Items()
+	err := q.spilledItems(func(item queueItem) error {
+		items = append(items, item)
+		return nil
+	})
+	if err != nil {
+		q.fail(fmt.Errorf("queue %s: %v", q.path, err))
+	}
+	return items
+}
+
+func (q *diskQueue) Err() error {
+	return q.err
+}
+
+func (q *diskQueue) Close() error {
+	q.file.Close()
+	if err := q.writer.Close(); err != nil {
+		return err
+	}
+	return os.Remove(q.path)
+}
@@ -0,0 +1,198 @@
+//go:build nats
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// URLs fetched from the stream at a time
+const natsBatch = 100
+
+// Queue in a NATS JetStream stream, so crawlers and other programs can
+// share it: nats://host:4222/STREAM. Priority URLs go to the subject
+// STREAM.priority, the others to STREAM.urls; crawlers sharing the
+// stream share the URLs through durable consumers. URLs are
+// acknowledged when fetched and kept in memory until popped; the ones
+// left are published again on Close.
+type natsQueue struct {
+	conn     *nats.Conn
+	js       nats.JetStreamContext
+	stream   string
+	priority *nats.Subscription
+	normal   *nats.Subscription
+	mem      *frontier
+	// URLs in the stream, as of the last fetch and the pushes since
+	pending map[*nats.Subscription]int
+	err     error
+}
+
+func newNATSQueue(spec string) (Queue, error) {
+	u, err := url.Parse(spec)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid -queue %s, expected nats://host:port/stream", spec)
+	}
+	stream := strings.Trim(u.Path, "/")
+	if stream == "" {
+		stream = "CRAWLER"
+	}
+	conn, err := nats.Connect((&url.URL{Scheme: u.Scheme, User: u.User, Host: u.Host}).String())
+	if err != nil {
+		return nil, err
+	}
+	q := &natsQueue{conn: conn, stream: stream, mem: &frontier{}, pending: make(map[*nats.Subscription]int)}
+	if err := q.subscribe(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("queue %s: %v", spec, err)
+	}
+	return q, nil
+}
+
+func (q *natsQueue) subscribe() error {
+	js, err := q.conn.JetStream()
+	if err != nil {
+		return err
+	}
+	q.js = js
+	if _, err := js.StreamInfo(q.stream); errors.Is(err, nats.ErrStreamNotFound) {
+		_, err = js.AddStream(&nats.StreamConfig{
+			Name:      q.stream,
+			Subjects:  []string{q.stream + ".priority", q.stream + ".urls"},
+			Retention: nats.WorkQueuePolicy,
+		})
+		if err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+	if q.priority, err = js.PullSubscribe(q.stream+".priority", q.stream+"-priority"); err != nil {
+		return err
+	}
+	if q.normal, err = js.PullSubscribe(q.stream+".urls", q.stream+"-urls"); err != nil {
+		return err
+	}
+	for _, sub := range []*nats.Subscription{q.priority, q.normal} {
+		info, err := sub.ConsumerInfo()
+		if err != nil {
+			return err
+		}
+		q.pending[sub] = int(info.NumPending)
+	}
+	return nil
+}
+
+func (q *natsQueue) fail(err error) {
+	if q.err == nil {
+		q.err = fmt.Errorf("queue %s: %v", q.stream, err)
+	}
+}
+
+func (q *natsQueue) Len() int {
+	return q.mem.Len() + q.pending[q.priority] + q.pending[q.normal]
+}
+
+func (q *natsQueue) publish(item queueItem) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	subject := q.stream + ".urls"
+	if item.Priority {
+		subject = q.stream + ".priority"
+	}
+	_, err = q.js.Publish(subject, data)
+	return err
+}
+
+func (q *natsQueue) Push(item queueItem) {
+	if err := q.publish(item); err != nil {
+		q.fail(err)
+		return
+	}
+	if item.Priority {
+		q.pending[q.priority]++
+	} else {
+		q.pending[q.normal]++
+	}
+}
+
+// Priority URLs are fetched first
+func (q *natsQueue) Pop(throttle *hostThrottle) queueItem {
+	if q.mem.Len() == 0 {
+		q.fetch(q.priority)
+	}
+	if q.mem.Len() == 0 {
+		q.fetch(q.normal)
+	}
+	if q.mem.Len() == 0 {
+		return queueItem{}
+	}
+	return q.mem.Pop(throttle)
+}
+
+func (q *natsQueue) fetch(sub *nats.Subscription) {
+	if q.pending[sub] == 0 {
+		return
+	}
+	msgs, err := sub.Fetch(natsBatch, nats.MaxWait(time.Second))
+	if errors.Is(err, nats.ErrTimeout) {
+		// Taken by another crawler
+		q.pending[sub] = 0
+		return
+	}
+	if err != nil {
+		q.fail(err)
+		return
+	}
+	for _, msg := range msgs {
+		var item queueItem
+		if err := json.Unmarshal(msg.Data, &item); err != nil {
+			fmt.Printf("Invalid URL in queue %s: %v\n", q.stream, err)
+		} else {
+			q.mem.Push(item)
+		}
+		if err := msg.Ack(); err != nil {
+			q.fail(err)
+		}
+		if meta, err := msg.Metadata(); err == nil {
+			q.pending[sub] = int(meta.NumPending)
+		}
+	}
+}
+
+// Only the URLs already fetched can be dropped
+func (q *natsQueue) Drop(match func(queueItem) bool) int {
+	return q.mem.Drop(match)
+}
+
+// Hosts of the URLs fetched, the stream is not read ahead
+func (q *natsQueue) HostLens() map[string]int {
+	return q.mem.HostLens()
+}
+
+// The URLs fetched, the others are kept by the stream
+func (q *natsQueue) Items() []queueItem {
+	return q.mem.Items()
+}
+
+func (q *natsQueue) Err() error {
+	return q.err
+}
+
+func (q *natsQueue) Close() error {
+	defer q.conn.Close()
+	for _, item := range q.mem.Items() {
+		if err := q.publish(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
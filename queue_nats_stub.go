@@ -0,0 +1,10 @@
+//go:build !nats
+
+package main
+
+import "errors"
+
+// The NATS queue needs nats.go: build with -tags nats
+func newNATSQueue(spec string) (Queue, error) {
+	return nil, errors.New("the NATS queue is not available, build with -tags nats")
+}
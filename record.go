@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// Path of the recorded response to a request, keyed by method, URL
+// and range
+func recordPath(dir string, req *http.Request) string {
+	key := req.Method + " " + req.URL.String()
+	if r := req.Header.Get("Range"); r != "" {
+		key += " " + r
+	}
+	sum := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(dir, name[:2], name)
+}
+
+// Save every response received in dir, to be replayed later
+type recordTransport struct {
+	dir       string
+	transport http.RoundTripper
+}
+
+func (rt *recordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := rt.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	// A body closed early is still read to the end, to replay it
+	return teeResponse(resp, recordPath(rt.dir, req), "", true, func(err error) error {
+		return fmt.Errorf("recording %s: %v", req.URL, err)
+	})
+}
+
+// Answer from the responses recorded in dir, without network: a
+// request never recorded fails
+type replayTransport struct {
+	dir string
+}
+
+func (rt *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	file, err := os.Open(recordPath(rt.dir, req))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s %s was not recorded", req.Method, req.URL)
+	}
+	if err != nil {
+		return nil, err
+	}
+	resp, err := readFileResponse(bufio.NewReader(file), file, req)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recording of %s: %v", req.URL, err)
+	}
+	return resp, nil
+}
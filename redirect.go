@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var (
+	errRedirectOutOfScope = errors.New("redirect leaves the allowed scope")
+	errRedirectScheme     = errors.New("redirect from HTTP to another scheme")
+)
+
+// Context key marking asset requests, whose redirects can leave the scope
+type assetRequestKey struct{}
+
+// Hop of a redirect chain
+type RedirectHop struct {
+	URL    string `json:"url"`
+	Status int    `json:"status"`
+}
+
+// A URL is in scope when it's on the host of the start URL, on one
+// of AllowDomains or, when starting from a local file, on a host
+// linked by it
+func (c *Crawler) inScope(u *url.URL) bool {
+	start, err := url.Parse(c.StartURL)
+	if err != nil {
+		return false
+	}
+	host := asciiHost(strings.ToLower(u.Hostname()))
+	if c.allowedDomain(host) {
+		return true
+	}
+	if start.Scheme == "file" {
+		return u.Scheme == "file" || c.seedHosts[host]
+	}
+	return host == asciiHost(strings.ToLower(start.Hostname()))
+}
+
+func (c *Crawler) addSeedHost(u *url.URL) {
+	if c.seedHosts == nil {
+		c.seedHosts = make(map[string]bool)
+	}
+	c.seedHosts[asciiHost(strings.ToLower(u.Hostname()))] = true
+}
+
+func (c *Crawler) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return fmt.Errorf("stopped after %d redirects", len(via))
+	}
+	// A remote page must not lead to local files, or to other schemes
+	origin := via[0].URL.Scheme
+	if (origin == "http" || origin == "https") && req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return errRedirectScheme
+	}
+	if asset, _ := req.Context().Value(assetRequestKey{}).(bool); asset {
+		return nil
+	}
+	if !c.OffsiteRedirects && !c.inScope(req.URL) {
+		return errRedirectOutOfScope
+	}
+	return nil
+}
+
+// Walk back the redirects that led to the response
+func redirectChain(resp *http.Response) []RedirectHop {
+	var hops []RedirectHop
+	for r := resp.Request.Response; r != nil; r = r.Request.Response {
+		hops = append([]RedirectHop{{URL: r.Request.URL.String(), Status: r.StatusCode}}, hops...)
+	}
+	return hops
+}
+
+// Request that started the redirect chain of resp
+func firstRequest(resp *http.Response) *http.Request {
+	req := resp.Request
+	for req.Response != nil {
+		req = req.Response.Request
+	}
+	return req
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// Target of the <meta http-equiv="refresh"> of the page, if any.
+// The content is "delay; url=target", the target may be quoted.
+func metaRefresh(doc *html.Node) (string, bool) {
+	var target string
+	var found bool
+	var find func(*html.Node)
+	find = func(n *html.Node) {
+		if found {
+			return
+		}
+		if n.Type == html.ElementNode && n.Data == "meta" &&
+			strings.EqualFold(getAttr(n, "http-equiv"), "refresh") {
+			if t, ok := parseRefresh(getAttr(n, "content")); ok {
+				target, found = t, true
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			find(c)
+		}
+	}
+	find(doc)
+	return target, found
+}
+
+func parseRefresh(content string) (string, bool) {
+	_, rest, ok := strings.Cut(content, ";")
+	if !ok {
+		_, rest, ok = strings.Cut(content, ",")
+	}
+	if !ok {
+		return "", false
+	}
+	rest = strings.TrimSpace(rest)
+	if len(rest) < 4 || !strings.EqualFold(rest[:3], "url") {
+		return "", false
+	}
+	rest = strings.TrimSpace(rest[3:])
+	if !strings.HasPrefix(rest, "=") {
+		return "", false
+	}
+	target := strings.TrimSpace(rest[1:])
+	if len(target) > 1 && (target[0] == '\'' || target[0] == '"') {
+		if end := strings.IndexByte(target[1:], target[0]); end >= 0 {
+			target = target[1 : end+1]
+		}
+	}
+	return target, target != ""
+}
+
+// A page refreshing to another URL is a redirect: the target is
+// queued and the page recorded as its alias instead of being saved
+func (c *Crawler) followRefresh(doc *html.Node, u *url.URL, rec PageRecord) (bool, error) {
+	link, ok := metaRefresh(doc)
+	if !ok {
+		return false, nil
+	}
+	ref, err := url.Parse(link)
+	if err != nil {
+		return false, nil
+	}
+	target := u.ResolveReference(ref)
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return false, nil
+	}
+	c.normalize(target)
+	urlStr, targetStr := u.String(), target.String()
+	if targetStr == urlStr {
+		// Page reloading itself
+		return false, nil
+	}
+	if !c.OffsiteRedirects && !c.inScope(target) {
+		fmt.Printf("Skip %s, meta refresh to %s out of scope\n", urlStr, targetStr)
+		c.skipped(urlStr, "meta refresh out of scope")
+		return true, c.markVisited(urlStr, rec)
+	}
+	fmt.Printf("Meta refresh %s -> %s\n", urlStr, targetStr)
+	rec.AliasOf = targetStr
+	rec.FetchedAt = time.Now()
+	if err := c.markVisited(urlStr, rec); err != nil {
+		return true, err
+	}
+	c.enqueue(queueItem{URL: targetStr, Referrer: urlStr, Depth: rec.Depth})
+	return true, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Line written to Results for every fetched page
+type PageResult struct {
+	URL      string   `json:"url"`
+	Status   int      `json:"status"`
+	Title    string   `json:"title,omitempty"`
+	SavePath string   `json:"save_path,omitempty"`
+	Depth    int      `json:"depth"`
+	Outlinks []string `json:"outlinks,omitempty"`
+}
+
+// Title of the page
+func pageTitle(doc *html.Node) string {
+	if doc.Type == html.ElementNode && doc.Data == "title" {
+		return nodeText(doc)
+	}
+	for child := doc.FirstChild; child != nil; child = child.NextSibling {
+		if title := pageTitle(child); title != "" {
+			return title
+		}
+	}
+	return ""
+}
+
+// Absolute URLs of the links of the page, without duplicates
+func pageOutlinks(doc *html.Node, u *url.URL) []string {
+	var links []string
+	seen := make(map[string]bool)
+	for _, link := range extractPageLinks(doc) {
+		href, _, _ := strings.Cut(strings.TrimSpace(link.Href), "#")
+		if href == "" {
+			continue
+		}
+		ref, err := url.Parse(href)
+		if err != nil || skippedSchemes[strings.ToLower(ref.Scheme)] {
+			continue
+		}
+		target := u.ResolveReference(ref).String()
+		if !seen[target] {
+			seen[target] = true
+			links = append(links, target)
+		}
+	}
+	return links
+}
+
+// Write the page to Results, if set; doc is nil for other files
+func (c *Crawler) writeResult(urlStr string, rec PageRecord, doc *html.Node, u *url.URL) error {
+	if c.Results == nil {
+		return nil
+	}
+	result := PageResult{URL: urlStr, Status: rec.Status, SavePath: rec.SavePath, Depth: rec.Depth}
+	if doc != nil {
+		result.Title = pageTitle(doc)
+		result.Outlinks = pageOutlinks(doc, u)
+	}
+	return json.NewEncoder(c.Results).Encode(result)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Rule rewriting discovered URLs, written like sed: s#regexp#replacement#g
+type rewriteRule struct {
+	re          *regexp.Regexp
+	replacement string
+	global      bool
+}
+
+// Parse s<d>regexp<d>replacement<d>[g], where <d> is any delimiter.
+// The replacement can use \1..\9 and & like sed.
+func parseRewriteRule(expr string) (rewriteRule, error) {
+	if len(expr) < 4 || expr[0] != 's' {
+		return rewriteRule{}, fmt.Errorf("invalid rewrite rule %s, expected s/regexp/replacement/", expr)
+	}
+	delim := expr[1]
+	var parts []string
+	var part strings.Builder
+	for i := 2; i < len(expr); i++ {
+		switch {
+		case expr[i] == '\\' && i+1 < len(expr) && expr[i+1] == delim:
+			part.WriteByte(delim)
+			i++
+		case expr[i] == '\\' && i+1 < len(expr):
+			part.WriteByte(expr[i])
+			part.WriteByte(expr[i+1])
+			i++
+		case expr[i] == delim:
+			parts = append(parts, part.String())
+			part.Reset()
+		default:
+			part.WriteByte(expr[i])
+		}
+	}
+	if len(parts) != 2 {
+		return rewriteRule{}, fmt.Errorf("invalid rewrite rule %s, expected s/regexp/replacement/", expr)
+	}
+	flags := part.String()
+	if flags != "" && flags != "g" {
+		return rewriteRule{}, fmt.Errorf("invalid flags %q in rewrite rule %s", flags, expr)
+	}
+	re, err := regexp.Compile(parts[0])
+	if err != nil {
+		return rewriteRule{}, err
+	}
+	return rewriteRule{re: re, replacement: sedReplacement(parts[1]), global: flags == "g"}, nil
+}
+
+// Convert a sed replacement to the regexp template syntax
+func sedReplacement(repl string) string {
+	var b strings.Builder
+	for i := 0; i < len(repl); i++ {
+		switch {
+		case repl[i] == '\\' && i+1 < len(repl):
+			i++
+			if repl[i] >= '0' && repl[i] <= '9' {
+				fmt.Fprintf(&b, "${%c}", repl[i])
+			} else if repl[i] == '$' {
+				b.WriteString("$$")
+			} else {
+				b.WriteByte(repl[i])
+			}
+		case repl[i] == '&':
+			b.WriteString("${0}")
+		case repl[i] == '$':
+			b.WriteString("$$")
+		default:
+			b.WriteByte(repl[i])
+		}
+	}
+	return b.String()
+}
+
+func (r rewriteRule) apply(s string) string {
+	if r.global {
+		return r.re.ReplaceAllString(s, r.replacement)
+	}
+	loc := r.re.FindStringSubmatchIndex(s)
+	if loc == nil {
+		return s
+	}
+	dst := r.re.ExpandString(nil, r.replacement, s, loc)
+	return s[:loc[0]] + string(dst) + s[loc[1]:]
+}
+
+// Apply the rewrite rules in order
+func (c *Crawler) rewriteURL(u *url.URL) {
+	if len(c.Rewrites) == 0 {
+		return
+	}
+	s := u.String()
+	for _, rule := range c.Rewrites {
+		s = rule.apply(s)
+	}
+	if rewritten, err := url.Parse(s); err == nil {
+		*u = *rewritten
+	}
+}
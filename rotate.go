@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// Headers of a browser, e.g. User-Agent, Accept and Accept-Language
+type HeaderProfile map[string]string
+
+// Profiles used with -rotate-headers builtin
+var builtinHeaderProfiles = []HeaderProfile{
+	{
+		"User-Agent":      "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+		"Accept":          "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8",
+		"Accept-Language": "en-US,en;q=0.9",
+	},
+	{
+		"User-Agent":      "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Safari/605.1.15",
+		"Accept":          "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+		"Accept-Language": "en-GB,en;q=0.9",
+	},
+	{
+		"User-Agent":      "Mozilla/5.0 (X11; Linux x86_64; rv:125.0) Gecko/20100101 Firefox/125.0",
+		"Accept":          "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+		"Accept-Language": "en-US,en;q=0.5",
+	},
+	{
+		"User-Agent":      "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1",
+		"Accept":          "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+		"Accept-Language": "en-US,en;q=0.9",
+	},
+}
+
+// Read the profiles of a JSON file, an array of header objects, or
+// the built-in ones for "builtin"
+func loadHeaderProfiles(path string) ([]HeaderProfile, error) {
+	if path == "" {
+		return nil, nil
+	}
+	if path == "builtin" {
+		return builtinHeaderProfiles, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var profiles []HeaderProfile
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("invalid -rotate-headers %s: %v", path, err)
+	}
+	if len(profiles) == 0 {
+		return nil, fmt.Errorf("no header profiles in %s", path)
+	}
+	return profiles, nil
+}
+
+// Send the headers of a random profile, picked for every request or
+// once per host. Headers set by the crawler, like Referer or Range,
+// are kept.
+type headerTransport struct {
+	profiles  []HeaderProfile
+	perHost   bool
+	transport http.RoundTripper
+
+	mu    sync.Mutex
+	hosts map[string]HeaderProfile
+}
+
+func (t *headerTransport) profile(host string) HeaderProfile {
+	if !t.perHost {
+		return t.profiles[rand.Intn(len(t.profiles))]
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.hosts == nil {
+		t.hosts = make(map[string]HeaderProfile)
+	}
+	profile, ok := t.hosts[host]
+	if !ok {
+		profile = t.profiles[rand.Intn(len(t.profiles))]
+		t.hosts[host] = profile
+	}
+	return profile
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for name, value := range t.profile(req.URL.Host) {
+		if req.Header.Get(name) == "" {
+			req.Header.Set(name, value)
+		}
+	}
+	return t.transport.RoundTrip(req)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Daily window the crawl runs in, e.g. 22:00-06:00 across midnight
+type activeHours struct {
+	// Minutes since midnight
+	start, end int
+	loc        *time.Location
+	text       string
+}
+
+// Parse start-end with an optional time zone, e.g.
+// "22:00-06:00 Europe/Rome"; the local time zone by default
+func parseActiveHours(value string) (*activeHours, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	window, zone, _ := strings.Cut(value, " ")
+	from, to, ok := strings.Cut(window, "-")
+	if !ok {
+		return nil, fmt.Errorf("invalid -active-hours %s, expected HH:MM-HH:MM [zone]", value)
+	}
+	h := &activeHours{loc: time.Local, text: value}
+	var err error
+	if h.start, err = parseClock(from); err != nil {
+		return nil, err
+	}
+	if h.end, err = parseClock(to); err != nil {
+		return nil, err
+	}
+	if h.start == h.end {
+		return nil, fmt.Errorf("invalid -active-hours %s, the window is empty", value)
+	}
+	if zone = strings.TrimSpace(zone); zone != "" {
+		if h.loc, err = time.LoadLocation(zone); err != nil {
+			return nil, fmt.Errorf("invalid -active-hours time zone %s: %v", zone, err)
+		}
+	}
+	return h, nil
+}
+
+// Minutes since midnight of HH:MM
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %s, expected HH:MM", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (h *activeHours) contains(t time.Time) bool {
+	t = t.In(h.loc)
+	minute := t.Hour()*60 + t.Minute()
+	if h.start < h.end {
+		return minute >= h.start && minute < h.end
+	}
+	return minute >= h.start || minute < h.end
+}
+
+// Next time the window opens after t
+func (h *activeHours) nextStart(t time.Time) time.Time {
+	t = t.In(h.loc)
+	start := time.Date(t.Year(), t.Month(), t.Day(), h.start/60, h.start%60, 0, 0, h.loc)
+	if !start.After(t) {
+		start = time.Date(t.Year(), t.Month(), t.Day()+1, h.start/60, h.start%60, 0, 0, h.loc)
+	}
+	return start
+}
+
+// Block outside the active hours. The state is saved after every
+// page and the frontier when the pause starts, a checkpoint is also
+// written when they are enabled.
+func (c *Crawler) waitActiveHours(ctx context.Context) error {
+	if c.ActiveHours == nil || c.ActiveHours.contains(time.Now()) {
+		return nil
+	}
+	resume := c.ActiveHours.nextStart(time.Now())
+	fmt.Printf("Outside the active hours %s, crawl paused until %s\n", c.ActiveHours.text, resume.Format(time.RFC3339))
+	c.progress.set("paused", "", c.queue.Len())
+	if err := c.saveFrontier(); err != nil {
+		return err
+	}
+	if c.CheckpointEvery > 0 {
+		if err := c.writeCheckpoint(); err != nil {
+			return err
+		}
+	}
+	for !c.ActiveHours.contains(time.Now()) {
+		select {
+		case <-time.After(time.Until(c.ActiveHours.nextStart(time.Now()))):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	fmt.Println("Active hours started, crawl resumed")
+	return nil
+}
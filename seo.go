@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// SEO data of a page, appended to seo.jsonl in the destination directory
+type PageSEO struct {
+	URL         string   `json:"url"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	H1          []string `json:"h1,omitempty"`
+	Canonical   string   `json:"canonical,omitempty"`
+	// Language of each alternate version of the page
+	Hreflang map[string]string `json:"hreflang,omitempty"`
+	// Meta robots and X-Robots-Tag directives
+	Robots    string `json:"robots,omitempty"`
+	WordCount int    `json:"word_count"`
+}
+
+const (
+	seoFileName   = "seo.jsonl"
+	seoReportName = "seo-report.txt"
+)
+
+// Pages sharing a title or a description, for the final report
+type seoIndex struct {
+	titles       map[string][]string
+	descriptions map[string][]string
+	noTitle      []string
+	noDesc       []string
+}
+
+func nodeText(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+func extractSEO(doc *html.Node, resp *http.Response, u *url.URL) PageSEO {
+	seo := PageSEO{URL: u.String()}
+	var robots []string
+	resolve := func(link string) string {
+		ref, err := url.Parse(link)
+		if err != nil {
+			return link
+		}
+		return u.ResolveReference(ref).String()
+	}
+	body := doc
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "title":
+				if seo.Title == "" {
+					seo.Title = nodeText(n)
+				}
+			case "h1":
+				seo.H1 = append(seo.H1, nodeText(n))
+			case "body":
+				body = n
+			case "meta":
+				switch strings.ToLower(getAttr(n, "name")) {
+				case "description":
+					seo.Description = getAttr(n, "content")
+				case "robots":
+					robots = append(robots, getAttr(n, "content"))
+				}
+			case "link":
+				rels := strings.Fields(strings.ToLower(getAttr(n, "rel")))
+				if slices.Contains(rels, "canonical") {
+					seo.Canonical = resolve(getAttr(n, "href"))
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	seo.Hreflang = hreflangLinks(doc, u)
+	robots = append(robots, resp.Header.Values("X-Robots-Tag")...)
+	seo.Robots = strings.Join(robots, ", ")
+	seo.WordCount = len(strings.Fields(pageText(body)))
+	return seo
+}
+
+// Write the SEO data of the page and index its title and description
+func (c *Crawler) recordSEO(doc *html.Node, resp *http.Response, u *url.URL) error {
+	seo := extractSEO(doc, resp, u)
+	if c.seo == nil {
+		c.seo = &seoIndex{titles: make(map[string][]string), descriptions: make(map[string][]string)}
+	}
+	if seo.Title == "" {
+		c.seo.noTitle = append(c.seo.noTitle, seo.URL)
+	} else {
+		c.seo.titles[seo.Title] = append(c.seo.titles[seo.Title], seo.URL)
+	}
+	if seo.Description == "" {
+		c.seo.noDesc = append(c.seo.noDesc, seo.URL)
+	} else {
+		c.seo.descriptions[seo.Description] = append(c.seo.descriptions[seo.Description], seo.URL)
+	}
+
+	if c.seoFile == nil {
+		os.MkdirAll(c.DestDir, os.ModePerm)
+		file, err := os.OpenFile(filepath.Join(c.DestDir, seoFileName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		c.seoFile = file
+	}
+	return json.NewEncoder(c.seoFile).Encode(seo)
+}
+
+// Write the site-wide report: pages with no title or description,
+// and titles and descriptions used by more than one page
+func (c *Crawler) writeSEOReport() error {
+	if c.seo == nil {
+		return nil
+	}
+	file, err := os.Create(filepath.Join(c.DestDir, seoReportName))
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+
+	writeList := func(header string, urls []string) {
+		if len(urls) == 0 {
+			return
+		}
+		fmt.Fprintf(w, "%s (%d)\n", header, len(urls))
+		for _, u := range urls {
+			fmt.Fprintf(w, "  %s\n", u)
+		}
+		fmt.Fprintln(w)
+	}
+	writeDuplicates := func(header string, index map[string][]string) {
+		var values []string
+		for value, urls := range index {
+			if len(urls) > 1 {
+				values = append(values, value)
+			}
+		}
+		if len(values) == 0 {
+			return
+		}
+		sort.Strings(values)
+		fmt.Fprintf(w, "%s (%d)\n", header, len(values))
+		for _, value := range values {
+			fmt.Fprintf(w, "  %q\n", value)
+			for _, u := range index[value] {
+				fmt.Fprintf(w, "    %s\n", u)
+			}
+		}
+		fmt.Fprintln(w)
+	}
+	writeList("Missing title", c.seo.noTitle)
+	writeList("Missing description", c.seo.noDesc)
+	writeDuplicates("Duplicate titles", c.seo.titles)
+	writeDuplicates("Duplicate descriptions", c.seo.descriptions)
+	// The first write error is kept by the buffer
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	fmt.Println("SEO report written to", file.Name())
+	return nil
+}
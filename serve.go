@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Web server of a mirror: with a single host its pages are served
+// from the root, with more hosts under /<host>/ so the links between
+// them keep working
+type mirrorServer struct {
+	dir   string
+	hosts []string
+	// Shortened paths of the files by the path they would have had
+	shortPaths map[string]string
+
+	mu      sync.Mutex
+	crawler *Crawler
+}
+
+func newMirrorServer(dir, naming string) (*mirrorServer, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	s := &mirrorServer{dir: dir, crawler: &Crawler{DestDir: dir, Naming: naming}}
+	for _, entry := range entries {
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			s.hosts = append(s.hosts, entry.Name())
+		}
+	}
+	if len(s.hosts) == 0 {
+		return nil, fmt.Errorf("no host directory in %s", dir)
+	}
+	sort.Strings(s.hosts)
+	s.shortPaths, err = loadShortPaths(dir)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Paths shortened by the crawl, from the manifest
+func loadShortPaths(dir string) (map[string]string, error) {
+	paths := make(map[string]string)
+	file, err := os.Open(filepath.Join(dir, manifestFileName))
+	if os.IsNotExist(err) {
+		return paths, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	decoder := json.NewDecoder(file)
+	for {
+		var entry ManifestEntry
+		if err := decoder.Decode(&entry); err == io.EOF {
+			return paths, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("invalid manifest: %v", err)
+		}
+		if entry.LongPath != "" {
+			paths[entry.LongPath] = entry.Path
+		}
+	}
+}
+
+func (s *mirrorServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	host, urlPath := s.hosts[0], path.Clean("/"+r.URL.Path)
+	if len(s.hosts) > 1 {
+		if urlPath == "/" {
+			s.listHosts(w)
+			return
+		}
+		host, urlPath, _ = strings.Cut(strings.TrimPrefix(urlPath, "/"), "/")
+		urlPath = "/" + urlPath
+		if !s.hasHost(host) {
+			http.NotFound(w, r)
+			return
+		}
+	}
+	// path.Clean drops the trailing slash of directories
+	if strings.HasSuffix(r.URL.Path, "/") && urlPath != "/" {
+		urlPath += "/"
+	}
+
+	file, ok := s.find(host, urlPath, r.URL.RawQuery)
+	if !ok && !strings.HasSuffix(urlPath, "/") {
+		// A directory saved with its index.html
+		if _, ok := s.find(host, urlPath+"/", r.URL.RawQuery); ok {
+			target := r.URL.Path + "/"
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+			return
+		}
+	}
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// The content type comes from the extension, or is sniffed
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
+func (s *mirrorServer) hasHost(host string) bool {
+	i := sort.SearchStrings(s.hosts, host)
+	return i < len(s.hosts) && s.hosts[i] == host
+}
+
+// File where the URL was saved; hash naming depends on the scheme
+func (s *mirrorServer) find(host, urlPath, rawQuery string) (string, bool) {
+	for _, scheme := range []string{"https", "http"} {
+		u := &url.URL{Scheme: scheme, Host: host, Path: urlPath, RawQuery: rawQuery}
+		s.mu.Lock()
+		// Names differing only by case can't be told apart here
+		s.crawler.caseNames = nil
+		file := s.crawler.localPath(u)
+		s.mu.Unlock()
+		if rel, err := filepath.Rel(s.dir, file); err == nil {
+			if short, ok := s.shortPaths[filepath.ToSlash(rel)]; ok {
+				file = filepath.Join(s.dir, short)
+			}
+		}
+		file = filepath.FromSlash(file)
+		if info, err := os.Stat(file); err == nil && !info.IsDir() {
+			return file, true
+		}
+	}
+	return "", false
+}
+
+func (s *mirrorServer) listHosts(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintln(w, "<!DOCTYPE html><title>Mirror</title><ul>")
+	for _, host := range s.hosts {
+		fmt.Fprintf(w, "<li><a href=\"/%s/\">%s</a></li>\n", url.PathEscape(host), html.EscapeString(host))
+	}
+	fmt.Fprintln(w, "</ul>")
+}
+
+// serve-mirror: browse the saved pages
+func serveMirror(args []string) error {
+	fs := flag.NewFlagSet("serve-mirror", flag.ExitOnError)
+	dir := fs.String("dir", "", "Directory of the mirror")
+	addr := fs.String("addr", ":8000", "Address to listen on")
+	naming := fs.String("naming", "tree", "File naming used by the crawl: tree, flat or hash")
+	fs.Parse(args)
+	if *dir == "" {
+		return fmt.Errorf("use command serve-mirror -dir <directory> [-addr :8000]")
+	}
+
+	server, err := newMirrorServer(*dir, *naming)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Serving %s on %s\n", *dir, *addr)
+	return http.ListenAndServe(*addr, server)
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RequestSigner authenticates the requests, e.g. adding a signature
+// header or signing the URL, before they are sent
+type RequestSigner interface {
+	Sign(req *http.Request) error
+}
+
+// SignerFunc turns a function into a RequestSigner
+type SignerFunc func(req *http.Request) error
+
+func (f SignerFunc) Sign(req *http.Request) error {
+	return f(req)
+}
+
+// Sign every request, redirects and revalidations included
+type signingTransport struct {
+	signer    RequestSigner
+	transport http.RoundTripper
+}
+
+func (t *signingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// A RoundTripper must not change the request it gets
+	req = req.Clone(req.Context())
+	if err := t.signer.Sign(req); err != nil {
+		return nil, fmt.Errorf("signing %s: %v", req.URL, err)
+	}
+	return t.transport.RoundTrip(req)
+}
+
+// Parse hmac:key=secret,header=X-Signature or
+// aws:region=us-east-1,service=s3; the secrets can come from the
+// environment, CRAWLER_SIGN_KEY and the AWS_* variables
+func parseSigner(value string) (RequestSigner, error) {
+	kind, spec, _ := strings.Cut(value, ":")
+	if kind == "" {
+		return nil, nil
+	}
+	params := make(map[string]string)
+	for _, pair := range strings.Split(spec, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid -sign parameter %s, expected name=value", pair)
+		}
+		params[k] = v
+	}
+	switch kind {
+	case "hmac":
+		key := params["key"]
+		if key == "" {
+			key = os.Getenv("CRAWLER_SIGN_KEY")
+		}
+		if key == "" {
+			return nil, fmt.Errorf("-sign hmac needs key= or CRAWLER_SIGN_KEY")
+		}
+		return &HMACSigner{Key: []byte(key), Header: params["header"], TimestampHeader: params["timestamp-header"]}, nil
+	case "aws":
+		signer := &SigV4Signer{
+			Region:       params["region"],
+			Service:      params["service"],
+			AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		}
+		if signer.Region == "" || signer.Service == "" {
+			return nil, fmt.Errorf("-sign aws needs region= and service=")
+		}
+		if signer.AccessKey == "" || signer.SecretKey == "" {
+			return nil, fmt.Errorf("-sign aws needs AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+		}
+		return signer, nil
+	}
+	return nil, fmt.Errorf("invalid -sign %s, expected hmac:key=... or aws:region=...,service=...", kind)
+}
+
+// HMACSigner puts in Header (X-Signature by default) the hex
+// HMAC-SHA256 of "METHOD\nPATH?QUERY\nTIMESTAMP", the Unix time
+// being sent in TimestampHeader (X-Timestamp by default)
+type HMACSigner struct {
+	Key             []byte
+	Header          string
+	TimestampHeader string
+}
+
+func (s *HMACSigner) Sign(req *http.Request) error {
+	header, timestampHeader := s.Header, s.TimestampHeader
+	if header == "" {
+		header = "X-Signature"
+	}
+	if timestampHeader == "" {
+		timestampHeader = "X-Timestamp"
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, s.Key)
+	fmt.Fprintf(mac, "%s\n%s\n%s", req.Method, req.URL.RequestURI(), timestamp)
+	req.Header.Set(timestampHeader, timestamp)
+	req.Header.Set(header, hex.EncodeToString(mac.Sum(nil)))
+	return nil
+}
+
+// SigV4Signer signs the requests with AWS Signature Version 4, for
+// S3 buckets and other AWS endpoints
+type SigV4Signer struct {
+	Region       string
+	Service      string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+}
+
+// SHA-256 of an empty body: the crawler sends none
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+func (s *SigV4Signer) Sign(req *http.Request) error {
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", emptyPayloadHash)
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+
+	// Host and the x-amz-* headers are signed
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, headers[name])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		emptyPayloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.Region + "/" + s.Service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), date)
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, s.Service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signedHeaders, signature))
+	return nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// Query sorted by name and value, encoded as RFC 3986 requires
+func canonicalQuery(values url.Values) string {
+	var pairs []string
+	for name, vals := range values {
+		for _, v := range vals {
+			pairs = append(pairs, sigV4Escape(name)+"="+sigV4Escape(v))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+func sigV4Escape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"hash/fnv"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	// Pages whose signatures differ in at most this many bits are
+	// near duplicates
+	simhashDistance = 3
+	// Words of each shingle; shorter pages are not compared
+	shingleSize = 3
+
+	nearDuplicatesFileName = "near-duplicates.txt"
+)
+
+// 64 bit SimHash of the word shingles of the text
+func simhash(text string) (uint64, bool) {
+	words := strings.Fields(strings.ToLower(text))
+	if len(words) < shingleSize {
+		return 0, false
+	}
+	var weights [64]int
+	for i := 0; i+shingleSize <= len(words); i++ {
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(words[i:i+shingleSize], " ")))
+		sum := h.Sum64()
+		for b := 0; b < 64; b++ {
+			if sum&(1<<b) != 0 {
+				weights[b]++
+			} else {
+				weights[b]--
+			}
+		}
+	}
+	var sig uint64
+	for b, w := range weights {
+		if w > 0 {
+			sig |= 1 << b
+		}
+	}
+	return sig, true
+}
+
+// Signatures of the pages seen. With 4 bands of 16 bits, two
+// signatures differing in up to 3 bits share at least one band,
+// so only the pages sharing a band are compared.
+type simIndex struct {
+	bands [4]map[uint16][]int
+	sigs  []uint64
+	urls  []string
+	// Near duplicates of each page, by index
+	clusters map[int][]string
+}
+
+func newSimIndex() *simIndex {
+	s := &simIndex{clusters: make(map[int][]string)}
+	for i := range s.bands {
+		s.bands[i] = make(map[uint16][]int)
+	}
+	return s
+}
+
+// Add the page, returning the first page it is a near duplicate of
+func (s *simIndex) add(urlStr string, sig uint64) (string, bool) {
+	for i := range s.bands {
+		for _, j := range s.bands[i][uint16(sig>>(16*i))] {
+			if bits.OnesCount64(sig^s.sigs[j]) <= simhashDistance {
+				s.clusters[j] = append(s.clusters[j], urlStr)
+				return s.urls[j], true
+			}
+		}
+	}
+	idx := len(s.sigs)
+	s.sigs = append(s.sigs, sig)
+	s.urls = append(s.urls, urlStr)
+	for i := range s.bands {
+		band := uint16(sig >> (16 * i))
+		s.bands[i][band] = append(s.bands[i][band], idx)
+	}
+	return "", false
+}
+
+// Check if the page is a near duplicate of one already crawled
+func (c *Crawler) nearDuplicate(urlStr string, doc *html.Node) (string, bool) {
+	sig, ok := simhash(pageText(doc))
+	if !ok {
+		return "", false
+	}
+	if c.simIndex == nil {
+		c.simIndex = newSimIndex()
+	}
+	return c.simIndex.add(urlStr, sig)
+}
+
+// Write the clusters of near duplicate pages, each starting with
+// the first page crawled
+func (c *Crawler) writeNearDuplicates() error {
+	if c.simIndex == nil || len(c.simIndex.clusters) == 0 {
+		return nil
+	}
+	file, err := os.Create(filepath.Join(c.DestDir, nearDuplicatesFileName))
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	for i, url := range c.simIndex.urls {
+		dups, ok := c.simIndex.clusters[i]
+		if !ok {
+			continue
+		}
+		fmt.Fprintln(w, url)
+		for _, dup := range dups {
+			fmt.Fprintf(w, "  %s\n", dup)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("%d clusters of near duplicates written to %s\n", len(c.simIndex.clusters), file.Name())
+	return nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Version of the state file written by saveState
+const stateVersion = 2
+
+// What is known about a crawled URL
+type PageRecord struct {
+	Status    int       `json:"status,omitempty"`
+	FetchedAt time.Time `json:"fetched_at,omitzero"`
+	Hash      string    `json:"hash,omitempty"`
+	Size      int64     `json:"size,omitempty"`
+	Depth     int       `json:"depth"`
+	SavePath  string    `json:"save_path,omitempty"`
+	Referrer  string    `json:"referrer,omitempty"`
+	// URL redirecting to another one, saved under that URL
+	AliasOf string `json:"alias_of,omitempty"`
+}
+
+// Map for the crawler status
+type State map[string]PageRecord
+
+// Layout of the state file
+type stateDocument struct {
+	Version int   `json:"version"`
+	Pages   State `json:"pages"`
+}
+
+func loadState(stateFile string) (State, error) {
+	state := make(State)
+	data, err := os.ReadFile(stateFile)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	state, version, err := decodeState(data)
+	if err != nil {
+		return nil, err
+	}
+	if version < stateVersion {
+		// Keep the original, the next save overwrites it
+		backup := fmt.Sprintf("%s.v%d", stateFile, version)
+		if err := os.WriteFile(backup, data, 0644); err != nil {
+			return nil, err
+		}
+		fmt.Printf("Migrated state %s from version %d to %d, the original is in %s\n", stateFile, version, stateVersion, backup)
+	}
+	return state, nil
+}
+
+// Steps upgrading the state document by one version, by the version
+// they upgrade from. Changing the layout of the state means bumping
+// stateVersion and adding the step from the previous one.
+var stateMigrations = map[int]func(map[string]json.RawMessage) (map[string]json.RawMessage, error){
+	1: migrateStateV1,
+}
+
+// The first state was a plain map from URL to true
+func migrateStateV1(fields map[string]json.RawMessage) (map[string]json.RawMessage, error) {
+	pages := make(State, len(fields))
+	for url := range fields {
+		pages[url] = PageRecord{}
+	}
+	data, err := json.Marshal(pages)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]json.RawMessage{"version": json.RawMessage("2"), "pages": data}, nil
+}
+
+// Version of the state document, 1 for the unversioned first format
+func documentVersion(fields map[string]json.RawMessage) (int, error) {
+	raw, ok := fields["version"]
+	if _, hasPages := fields["pages"]; !ok || !hasPages {
+		return 1, nil
+	}
+	var version int
+	if err := json.Unmarshal(raw, &version); err != nil {
+		return 0, fmt.Errorf("invalid state version %s", raw)
+	}
+	return version, nil
+}
+
+// Decode the state, migrating it from older versions, and return the
+// version it was written with
+func decodeState(data []byte) (State, int, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, 0, err
+	}
+	version, err := documentVersion(fields)
+	if err != nil {
+		return nil, 0, err
+	}
+	if version > stateVersion {
+		return nil, 0, fmt.Errorf("state version %d is newer than the supported %d", version, stateVersion)
+	}
+	for v := version; v < stateVersion; v++ {
+		migrate, ok := stateMigrations[v]
+		if !ok {
+			return nil, 0, fmt.Errorf("no migration of the state from version %d", v)
+		}
+		if fields, err = migrate(fields); err != nil {
+			return nil, 0, fmt.Errorf("migrating the state from version %d: %v", v, err)
+		}
+	}
+
+	var pages State
+	if raw, ok := fields["pages"]; ok {
+		if err := json.Unmarshal(raw, &pages); err != nil {
+			return nil, 0, err
+		}
+	}
+	if pages == nil {
+		pages = make(State)
+	}
+	return pages, version, nil
+}
+
+// Write the state to a temporary file and move it in place, so a
+// crash never leaves a truncated state
+func saveState(state State, stateFile string) error {
+	tmp := stateFile + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(file)
+	if err := encoder.Encode(stateDocument{Version: stateVersion, Pages: state}); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, stateFile)
+}
+
+// Drop the records fetched more than ttl ago (when ttl > 0) and the
+// ones rejected by keep (when not nil), returning how many
+func compactState(state State, ttl time.Duration, keep func(string) bool, now time.Time) int {
+	dropped := 0
+	for url, rec := range state {
+		if !recordKept(url, rec, ttl, keep, now) {
+			delete(state, url)
+			dropped++
+		}
+	}
+	return dropped
+}
+
+// Records with an unknown fetch time never expire
+func recordKept(url string, rec PageRecord, ttl time.Duration, keep func(string) bool, now time.Time) bool {
+	if ttl > 0 && !rec.FetchedAt.IsZero() && now.Sub(rec.FetchedAt) > ttl {
+		return false
+	}
+	return keep == nil || keep(url)
+}
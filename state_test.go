@@ -0,0 +1,107 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDecodeState(t *testing.T) {
+	fetched := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		data    string
+		version int
+		want    State
+		wantErr bool
+	}{
+		{
+			name:    "version 1",
+			data:    `{"http://a.com/":true,"http://a.com/b.html":true}`,
+			version: 1,
+			want:    State{"http://a.com/": {}, "http://a.com/b.html": {}},
+		},
+		{
+			name:    "empty version 1",
+			data:    `{}`,
+			version: 1,
+			want:    State{},
+		},
+		{
+			name:    "version 2",
+			data:    `{"version":2,"pages":{"http://a.com/":{"status":200,"fetched_at":"2024-05-01T12:00:00Z","depth":1,"referrer":"http://a.com/x"}}}`,
+			version: 2,
+			want:    State{"http://a.com/": {Status: 200, FetchedAt: fetched, Depth: 1, Referrer: "http://a.com/x"}},
+		},
+		{
+			name:    "newer version",
+			data:    `{"version":3,"pages":{}}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid version",
+			data:    `{"version":"x","pages":{}}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid JSON",
+			data:    `[`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, version, err := decodeState([]byte(tt.data))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("no error, got version %d", version)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if version != tt.version {
+				t.Errorf("got version %d, want %d", version, tt.version)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for url, rec := range tt.want {
+				if got[url] != rec {
+					t.Errorf("%s: got %+v, want %+v", url, got[url], rec)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadStateMigration(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	v1 := []byte(`{"http://a.com/":true}`)
+	if err := os.WriteFile(stateFile, v1, 0644); err != nil {
+		t.Fatal(err)
+	}
+	state, err := loadState(stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := state["http://a.com/"]; !ok || len(state) != 1 {
+		t.Fatalf("got %v", state)
+	}
+	backup, err := os.ReadFile(stateFile + ".v1")
+	if err != nil || string(backup) != string(v1) {
+		t.Fatalf("backup %q, %v", backup, err)
+	}
+	if err := saveState(state, stateFile); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, version, err := decodeState(data); err != nil || version != stateVersion {
+		t.Errorf("saved version %d, %v", version, err)
+	}
+}
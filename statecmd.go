@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// state: maintenance of the state file
+func runState(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("use command state compact|export|import")
+	}
+	switch args[0] {
+	case "compact":
+		return stateCompact(args[1:])
+	case "export":
+		return stateExport(args[1:])
+	case "import":
+		return stateImport(args[1:])
+	}
+	return fmt.Errorf("unknown state command %s", args[0])
+}
+
+// state compact: drop old records and the ones out of the scope of
+// the start URL, rewriting the state and the visited log
+func stateCompact(args []string) error {
+	fs := flag.NewFlagSet("state compact", flag.ExitOnError)
+	stateFile := fs.String("state", "state.json", "State file")
+	ttl := fs.Duration("ttl", 0, "Drop records fetched longer ago than this (0 to keep them)")
+	startURL := fs.String("start", "", "Drop records out of the scope of this URL")
+	allowDomains := fs.String("allow-domains", "", "Other domains in scope, e.g. example.org,*.example.org")
+	sharded := fs.Bool("shard-state", false, "The state is kept in a file per host, state.<host>.json (detected if they exist)")
+	fs.Parse(args)
+
+	domains, err := parseAllowDomains(*allowDomains)
+	if err != nil {
+		return err
+	}
+	var keep func(string) bool
+	if *startURL != "" {
+		c := &Crawler{StartURL: *startURL, AllowDomains: domains}
+		keep = func(link string) bool {
+			u, err := url.Parse(link)
+			return err == nil && c.inScope(u)
+		}
+	}
+	now := time.Now()
+
+	state, found, err := loadShardedState(*stateFile)
+	if err != nil {
+		return err
+	}
+	total := len(state)
+	dropped := compactState(state, *ttl, keep, now)
+	if err := saveStateFiles(state, *stateFile, *sharded || found); err != nil {
+		return err
+	}
+	fmt.Printf("%s: %d records, %d dropped\n", *stateFile, total, dropped)
+
+	logFile := visitedLogFile(*stateFile)
+	if _, err := os.Stat(logFile); err == nil {
+		total, dropped, err := compactVisitedLog(logFile, *ttl, keep, now)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: %d records, %d dropped\n", logFile, total, dropped)
+	}
+	return nil
+}
+
+func saveStateFiles(state State, stateFile string, sharded bool) error {
+	if sharded {
+		return saveShardedState(state, stateFile)
+	}
+	return saveState(state, stateFile)
+}
+
+// Filter the visited log line by line into a new file, then replace it
+func compactVisitedLog(logFile string, ttl time.Duration, keep func(string) bool, now time.Time) (int, int, error) {
+	in, err := os.Open(logFile)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer in.Close()
+	tmp := logFile + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return 0, 0, err
+	}
+	writer := bufio.NewWriter(out)
+
+	total, dropped := 0, 0
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		var entry visitedEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			out.Close()
+			return 0, 0, err
+		}
+		total++
+		if !recordKept(entry.URL, entry.PageRecord, ttl, keep, now) {
+			dropped++
+			continue
+		}
+		writer.WriteString(line)
+		writer.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		out.Close()
+		return 0, 0, err
+	}
+	if err := writer.Flush(); err != nil {
+		out.Close()
+		return 0, 0, err
+	}
+	if err := out.Close(); err != nil {
+		return 0, 0, err
+	}
+	return total, dropped, os.Rename(tmp, logFile)
+}
+
+// Columns of the CSV export
+var stateColumns = []string{"url", "status", "fetched_at", "hash", "size", "depth", "save_path", "referrer", "alias_of"}
+
+// state export: write the records as CSV or JSONL
+func stateExport(args []string) error {
+	fs := flag.NewFlagSet("state export", flag.ExitOnError)
+	stateFile := fs.String("state", "state.json", "State file")
+	format := fs.String("format", "jsonl", "Output format: csv or jsonl")
+	output := fs.String("o", "", "Output file (stdout if empty)")
+	fs.Parse(args)
+
+	state, _, err := loadShardedState(*stateFile)
+	if err != nil {
+		return err
+	}
+	// Compact visited sets keep the records in the visited log
+	if file, err := os.Open(visitedLogFile(*stateFile)); err == nil {
+		logged, err := readStateJSONL(file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+		for u, rec := range logged {
+			state[u] = rec
+		}
+	}
+	urls := make([]string, 0, len(state))
+	for u := range state {
+		urls = append(urls, u)
+	}
+	sort.Strings(urls)
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	switch *format {
+	case "csv":
+		writer := csv.NewWriter(w)
+		writer.Write(stateColumns)
+		for _, u := range urls {
+			rec := state[u]
+			fetchedAt := ""
+			if !rec.FetchedAt.IsZero() {
+				fetchedAt = rec.FetchedAt.Format(time.RFC3339)
+			}
+			writer.Write([]string{
+				u, strconv.Itoa(rec.Status), fetchedAt, rec.Hash,
+				strconv.FormatInt(rec.Size, 10), strconv.Itoa(rec.Depth),
+				rec.SavePath, rec.Referrer, rec.AliasOf,
+			})
+		}
+		writer.Flush()
+		return writer.Error()
+	case "jsonl":
+		encoder := json.NewEncoder(w)
+		for _, u := range urls {
+			if err := encoder.Encode(visitedEntry{URL: u, PageRecord: state[u]}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown format %s, expected csv or jsonl", *format)
+}
+
+// state import: merge records from CSV or JSONL into the state. CSV
+// files without the export header and JSONL lines that are not
+// objects are read as plain URL lists.
+func stateImport(args []string) error {
+	fs := flag.NewFlagSet("state import", flag.ExitOnError)
+	stateFile := fs.String("state", "state.json", "State file")
+	format := fs.String("format", "jsonl", "Input format: csv or jsonl")
+	input := fs.String("i", "", "Input file (stdin if empty)")
+	sharded := fs.Bool("shard-state", false, "The state is kept in a file per host, state.<host>.json (detected if they exist)")
+	fs.Parse(args)
+
+	var r io.Reader = os.Stdin
+	if *input != "" {
+		file, err := os.Open(*input)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	var imported State
+	var err error
+	switch *format {
+	case "csv":
+		imported, err = readStateCSV(r)
+	case "jsonl":
+		imported, err = readStateJSONL(r)
+	default:
+		return fmt.Errorf("unknown format %s, expected csv or jsonl", *format)
+	}
+	if err != nil {
+		return err
+	}
+
+	state, found, err := loadShardedState(*stateFile)
+	if err != nil {
+		return err
+	}
+	added := 0
+	for u, rec := range imported {
+		if _, ok := state[u]; !ok {
+			added++
+		} else if rec == (PageRecord{}) {
+			// A bare URL doesn't replace what is known
+			continue
+		}
+		state[u] = rec
+	}
+	if err := saveStateFiles(state, *stateFile, *sharded || found); err != nil {
+		return err
+	}
+	fmt.Printf("Imported %d records, %d new\n", len(imported), added)
+	return nil
+}
+
+func readStateCSV(r io.Reader) (State, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	state := make(State)
+	if len(rows) == 0 {
+		return state, nil
+	}
+	// Column positions from the header, or the URL alone in the first column
+	columns := map[string]int{"url": 0}
+	if strings.EqualFold(strings.TrimSpace(rows[0][0]), "url") {
+		for i, name := range rows[0] {
+			columns[strings.ToLower(strings.TrimSpace(name))] = i
+		}
+		rows = rows[1:]
+	}
+	field := func(row []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+	for _, row := range rows {
+		u := field(row, "url")
+		if u == "" {
+			continue
+		}
+		var rec PageRecord
+		rec.Status, _ = strconv.Atoi(field(row, "status"))
+		rec.FetchedAt, _ = time.Parse(time.RFC3339, field(row, "fetched_at"))
+		rec.Hash = field(row, "hash")
+		rec.Size, _ = strconv.ParseInt(field(row, "size"), 10, 64)
+		rec.Depth, _ = strconv.Atoi(field(row, "depth"))
+		rec.SavePath = field(row, "save_path")
+		rec.Referrer = field(row, "referrer")
+		rec.AliasOf = field(row, "alias_of")
+		state[u] = rec
+	}
+	return state, nil
+}
+
+func readStateJSONL(r io.Reader) (State, error) {
+	state := make(State)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		entry := visitedEntry{URL: line}
+		if strings.HasPrefix(line, "{") {
+			if err := json.Unmarshal([]byte(line), &entry); err != nil {
+				return nil, err
+			}
+		}
+		if entry.URL != "" {
+			state[entry.URL] = entry.PageRecord
+		}
+	}
+	return state, scanner.Err()
+}
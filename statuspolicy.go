@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// What to do with a response of a given status: "save" it (the
+// default), "skip" it, "retry" it right away up to Retries times,
+// "requeue-later" at the end of the queue up to MaxRetries times, or
+// "abort" the crawl
+type StatusAction struct {
+	Action  string
+	Retries int
+}
+
+// Parse code=action pairs, e.g. 404=skip, 5xx=retry:3; a code can be
+// a class like 5xx
+func parseStatusPolicies(values []string) (map[string]StatusAction, error) {
+	policies := make(map[string]StatusAction)
+	for _, value := range values {
+		code, action, ok := strings.Cut(value, "=")
+		code = strings.ToLower(strings.TrimSpace(code))
+		valid := len(code) == 3 && code[0] >= '1' && code[0] <= '5'
+		if valid && code[1:] != "xx" {
+			_, err := strconv.Atoi(code)
+			valid = err == nil
+		}
+		if !ok || !valid {
+			return nil, fmt.Errorf("invalid -on %s, expected code=action, e.g. 404=skip", value)
+		}
+		name, retries, _ := strings.Cut(strings.TrimSpace(action), ":")
+		policy := StatusAction{Action: name}
+		switch name {
+		case "save", "skip", "requeue-later", "abort":
+		case "retry":
+			policy.Retries = 1
+			if retries != "" {
+				n, err := strconv.Atoi(retries)
+				if err != nil || n < 1 {
+					return nil, fmt.Errorf("invalid -on %s, expected retry:N", value)
+				}
+				policy.Retries = n
+			}
+		default:
+			return nil, fmt.Errorf("invalid -on action %s, expected save, skip, retry[:N], requeue-later or abort", action)
+		}
+		policies[code] = policy
+	}
+	return policies, nil
+}
+
+// Policy of the status: the one of the code, else the one of its class
+func (c *Crawler) statusAction(status int) StatusAction {
+	code := strconv.Itoa(status)
+	if policy, ok := c.StatusPolicies[code]; ok {
+		return policy
+	}
+	if policy, ok := c.StatusPolicies[code[:1]+"xx"]; ok {
+		return policy
+	}
+	return StatusAction{Action: "save"}
+}
+
+// Apply the policy of the response status, returning true if the
+// page must not be processed further
+func (c *Crawler) applyStatusPolicy(item queueItem, resp *http.Response) (bool, error) {
+	policy := c.statusAction(resp.StatusCode)
+	if policy.Action == "save" {
+		return false, nil
+	}
+	resp.Body.Close()
+	switch policy.Action {
+	case "abort":
+		return true, fmt.Errorf("got %d for %s, aborting the crawl", resp.StatusCode, item.URL)
+	case "retry", "requeue-later":
+		limit := policy.Retries
+		if policy.Action == "requeue-later" {
+			limit = c.MaxRetries
+		}
+		if item.Attempts < limit {
+			fmt.Printf("Got %d for %s, %s\n", resp.StatusCode, item.URL, policy.Action)
+			item.Attempts++
+			if policy.Action == "retry" {
+				item.Priority = true
+			}
+			c.queue.Push(item)
+			return true, nil
+		}
+		fmt.Printf("Giving up on %s after %d retries\n", item.URL, item.Attempts)
+		c.skipped(item.URL, fmt.Sprintf("status %d after %d retries", resp.StatusCode, item.Attempts))
+	default:
+		fmt.Printf("Skip %s, status %d\n", item.URL, resp.StatusCode)
+		c.skipped(item.URL, fmt.Sprintf("status %d", resp.StatusCode))
+	}
+	return true, c.markVisited(item.URL, PageRecord{
+		Status:    resp.StatusCode,
+		FetchedAt: time.Now(),
+		Depth:     item.Depth,
+		Referrer:  item.Referrer,
+	})
+}
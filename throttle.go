@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Largest slow down of the adaptive mode
+const maxSlowdown = 32
+
+// Per-host rate limiter: a host can be paused until a given time.
+// Requests to the same host are spaced by base, randomized by
+// ±jitter; in adaptive mode the spacing grows when the host answers
+// 429/503 or slows down, and shrinks back when it recovers.
+type hostThrottle struct {
+	base     time.Duration
+	jitter   float64
+	adaptive bool
+
+	mu    sync.Mutex
+	next  map[string]time.Time
+	hosts map[string]*hostPace
+}
+
+// Adaptive status of a host
+type hostPace struct {
+	slowdown float64
+	// Moving average of the response time
+	latency time.Duration
+}
+
+func newHostThrottle(base time.Duration, jitter float64, adaptive bool) *hostThrottle {
+	return &hostThrottle{
+		base:     base,
+		jitter:   jitter,
+		adaptive: adaptive,
+		next:     make(map[string]time.Time),
+		hosts:    make(map[string]*hostPace),
+	}
+}
+
+// Time left before the host can be requested
+func (t *hostThrottle) delay(host string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return time.Until(t.next[host])
+}
+
+// Block until the host can be requested or the context is done
+func (t *hostThrottle) wait(ctx context.Context, host string) error {
+	d := t.delay(host)
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Don't request the host for the given duration
+func (t *hostThrottle) pause(host string, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if until := time.Now().Add(d); until.After(t.next[host]) {
+		t.next[host] = until
+	}
+}
+
+// Change the delay between requests to the same host
+func (t *hostThrottle) setBase(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.base = max(d, 0)
+}
+
+func (t *hostThrottle) baseDelay() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.base
+}
+
+// Record the outcome of a request to the host and schedule the next one
+func (t *hostThrottle) done(host string, status int, latency time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	pace, ok := t.hosts[host]
+	if !ok {
+		pace = &hostPace{slowdown: 1, latency: latency}
+		t.hosts[host] = pace
+	}
+	if t.adaptive {
+		switch {
+		case status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable || status == 0:
+			pace.slowdown *= 2
+		case latency > 3*pace.latency && latency > 500*time.Millisecond:
+			pace.slowdown *= 1.5
+		default:
+			pace.slowdown *= 0.9
+		}
+		pace.slowdown = min(max(pace.slowdown, 1), maxSlowdown)
+	}
+	pace.latency = (pace.latency*7 + latency) / 8
+
+	interval := t.base
+	if pace.slowdown > 1 {
+		// Without a base delay the host is slowed relative to its response time
+		unit := max(t.base, pace.latency)
+		interval = time.Duration(float64(unit) * pace.slowdown)
+	}
+	if t.jitter > 0 && interval > 0 {
+		interval = time.Duration(float64(interval) * (1 + t.jitter*(2*rand.Float64()-1)))
+	}
+	if until := time.Now().Add(interval); until.After(t.next[host]) {
+		t.next[host] = until
+	}
+}
+
+// Retry-After is either a number of seconds or an HTTP date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			seconds = 0
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if d := date.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
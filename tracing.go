@@ -0,0 +1,63 @@
+//go:build otel
+
+package main
+
+import (
+	"context"
+	"net/url"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/niqt/crawler")
+
+// Export the spans to the OTLP/HTTP collector at endpoint (host:port
+// or URL); without an endpoint spans are not recorded
+func startTracing(ctx context.Context, endpoint string) (func(context.Context) error, error) {
+	if endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(endpoint), otlptracehttp.WithInsecure()}
+	if u, err := url.Parse(endpoint); err == nil && u.Host != "" {
+		opts = []otlptracehttp.Option{otlptracehttp.WithEndpointURL(endpoint)}
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", "crawler")))
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Start a span of a crawl stage for the URL; the returned function
+// ends it, recording the error if any
+func startSpan(ctx context.Context, name, urlStr string) (context.Context, func(error)) {
+	attrs := []attribute.KeyValue{attribute.String("url.full", urlStr)}
+	if host := hostname(urlStr); host != "" {
+		attrs = append(attrs, attribute.String("server.address", host))
+	}
+	ctx, span := tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+	return ctx, func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+// Add the HTTP status to the current span
+func spanStatus(ctx context.Context, status int) {
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("http.response.status_code", status))
+}
@@ -0,0 +1,22 @@
+//go:build !otel
+
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+// Tracing needs the OpenTelemetry SDK: build with -tags otel
+func startTracing(ctx context.Context, endpoint string) (func(context.Context) error, error) {
+	if endpoint != "" {
+		return nil, errors.New("tracing is not available, build with -tags otel")
+	}
+	return func(context.Context) error { return nil }, nil
+}
+
+func startSpan(ctx context.Context, name, urlStr string) (context.Context, func(error)) {
+	return ctx, func(error) {}
+}
+
+func spanStatus(ctx context.Context, status int) {}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Transformations of the saved pages
+var transformNames = map[string]bool{
+	"strip-js":     true,
+	"strip-pixels": true,
+	"minify":       true,
+	"prettify":     true,
+}
+
+// Parse the -transform list, e.g. strip-js,minify
+func parseTransforms(value string) (map[string]bool, error) {
+	transforms := make(map[string]bool)
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !transformNames[name] {
+			return nil, fmt.Errorf("invalid -transform %s, expected strip-js, strip-pixels, minify or prettify", name)
+		}
+		transforms[name] = true
+	}
+	if transforms["minify"] && transforms["prettify"] {
+		return nil, fmt.Errorf("invalid -transform, minify and prettify exclude each other")
+	}
+	return transforms, nil
+}
+
+// Elements whose text is kept as it is by minify and prettify
+var preformatted = map[string]bool{
+	"pre":      true,
+	"textarea": true,
+	"script":   true,
+	"style":    true,
+}
+
+// Elements whose children prettify puts on their own lines
+var blockElements = map[string]bool{
+	"html": true, "head": true, "body": true, "div": true, "section": true,
+	"article": true, "nav": true, "header": true, "footer": true, "main": true,
+	"aside": true, "ul": true, "ol": true, "dl": true, "table": true,
+	"thead": true, "tbody": true, "tfoot": true, "tr": true, "form": true,
+	"fieldset": true, "select": true, "figure": true, "blockquote": true,
+}
+
+// Changes made to the tree, undone in reverse order
+type domEdits []func()
+
+func (e *domEdits) setAttr(attr *html.Attribute, value string) {
+	old := attr.Val
+	attr.Val = value
+	*e = append(*e, func() { attr.Val = old })
+}
+
+func (e *domEdits) setAttrs(n *html.Node, attrs []html.Attribute) {
+	old := n.Attr
+	n.Attr = attrs
+	*e = append(*e, func() { n.Attr = old })
+}
+
+func (e *domEdits) setText(n *html.Node, text string) {
+	old := n.Data
+	n.Data = text
+	*e = append(*e, func() { n.Data = old })
+}
+
+func (e *domEdits) remove(n *html.Node) {
+	parent, next := n.Parent, n.NextSibling
+	parent.RemoveChild(n)
+	*e = append(*e, func() { parent.InsertBefore(n, next) })
+}
+
+func (e *domEdits) insertBefore(parent, n, ref *html.Node) {
+	parent.InsertBefore(n, ref)
+	*e = append(*e, func() { parent.RemoveChild(n) })
+}
+
+func (e *domEdits) undo() {
+	for i := len(*e) - 1; i >= 0; i-- {
+		(*e)[i]()
+	}
+	*e = nil
+}
+
+// Apply the Transforms to the tree
+func (c *Crawler) transformDOM(doc *html.Node, edits *domEdits) {
+	var walk func(n *html.Node, pre bool)
+	walk = func(n *html.Node, pre bool) {
+		for child := n.FirstChild; child != nil; {
+			next := child.NextSibling
+			switch {
+			case c.Transforms["strip-js"] && isScript(child),
+				c.Transforms["strip-pixels"] && isTrackingPixel(child),
+				c.Transforms["minify"] && child.Type == html.CommentNode:
+				edits.remove(child)
+			case child.Type == html.TextNode && !pre && (c.Transforms["minify"] || c.Transforms["prettify"]):
+				c.transformText(n, child, edits)
+			case child.Type == html.ElementNode:
+				if c.Transforms["strip-js"] {
+					stripHandlers(child, edits)
+				}
+				walk(child, pre || preformatted[child.Data])
+			}
+			child = next
+		}
+	}
+	walk(doc, false)
+	if c.Transforms["prettify"] {
+		// The document is not a block: <html> gets level 0
+		indent(doc, -1, edits)
+	}
+}
+
+// Collapse the whitespace of a text node, dropping it between the
+// children of block elements
+func (c *Crawler) transformText(parent, n *html.Node, edits *domEdits) {
+	if strings.TrimSpace(n.Data) == "" && (parent.Type == html.DocumentNode || blockElements[parent.Data]) {
+		edits.remove(n)
+		return
+	}
+	if c.Transforms["minify"] {
+		collapsed := strings.Join(strings.Fields(n.Data), " ")
+		if startsWithSpace(n.Data) {
+			collapsed = " " + collapsed
+		}
+		if endsWithSpace(n.Data) && strings.TrimSpace(n.Data) != "" {
+			collapsed += " "
+		}
+		if collapsed != n.Data {
+			edits.setText(n, collapsed)
+		}
+	}
+}
+
+func startsWithSpace(s string) bool {
+	return s != "" && strings.ContainsRune(" \t\n\r\f", rune(s[0]))
+}
+
+func endsWithSpace(s string) bool {
+	return s != "" && strings.ContainsRune(" \t\n\r\f", rune(s[len(s)-1]))
+}
+
+// Put the children of block elements on their own indented lines,
+// unless the element has text of its own
+func indent(n *html.Node, level int, edits *domEdits) {
+	block := n.Type == html.ElementNode && blockElements[n.Data] && !hasText(n)
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if block {
+			ws := &html.Node{Type: html.TextNode, Data: "\n" + strings.Repeat("  ", level+1)}
+			edits.insertBefore(n, ws, child)
+		}
+		if child.Type == html.ElementNode && !preformatted[child.Data] {
+			indent(child, level+1, edits)
+		}
+	}
+	if block && n.FirstChild != nil {
+		ws := &html.Node{Type: html.TextNode, Data: "\n" + strings.Repeat("  ", level)}
+		edits.insertBefore(n, ws, nil)
+	}
+}
+
+func hasText(n *html.Node) bool {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.TextNode && strings.TrimSpace(child.Data) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Scripts run by the browser; JSON-LD and other data blocks are kept
+func isScript(n *html.Node) bool {
+	if n.Type != html.ElementNode || n.Data != "script" {
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(getAttr(n, "type"))) {
+	case "", "text/javascript", "application/javascript", "module":
+		return true
+	}
+	return false
+}
+
+// Images of at most 1x1 pixels, like analytics beacons
+func isTrackingPixel(n *html.Node) bool {
+	if n.Type != html.ElementNode || n.Data != "img" {
+		return false
+	}
+	width, err1 := strconv.Atoi(strings.TrimSuffix(getAttr(n, "width"), "px"))
+	height, err2 := strconv.Atoi(strings.TrimSuffix(getAttr(n, "height"), "px"))
+	return err1 == nil && err2 == nil && width <= 1 && height <= 1
+}
+
+// Drop the event handler attributes and the javascript: links
+func stripHandlers(n *html.Node, edits *domEdits) {
+	var attrs []html.Attribute
+	changed := false
+	for _, attr := range n.Attr {
+		key := strings.ToLower(attr.Key)
+		value := strings.ToLower(strings.TrimSpace(attr.Val))
+		if strings.HasPrefix(key, "on") || (linkAttrs[n.Data] == key && strings.HasPrefix(value, "javascript:")) {
+			changed = true
+			continue
+		}
+		attrs = append(attrs, attr)
+	}
+	if changed {
+		edits.setAttrs(n, attrs)
+	}
+}
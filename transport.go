@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// Build the HTTP client used by the crawler
+func (c *Crawler) newClient() (*http.Client, error) {
+	if c.ReplayDir != "" {
+		c.plainTransport = &replayTransport{dir: c.ReplayDir}
+		return &http.Client{Transport: c.plainTransport, CheckRedirect: c.checkRedirect}, nil
+	}
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	resolver := newDNSResolver(c.DNSServer, c.DNSTTL, c.PreferIP, c.Resolve)
+	base.DialContext = resolver.DialContext
+
+	var transport http.RoundTripper = base
+	switch c.HTTPVersion {
+	case "", "auto":
+		// HTTP/2 when the server offers it, HTTP/1.1 otherwise
+	case "1.1":
+		base.Protocols = new(http.Protocols)
+		base.Protocols.SetHTTP1(true)
+	case "2":
+		// Unencrypted HTTP/2 is used with prior knowledge for http:// URLs
+		base.Protocols = new(http.Protocols)
+		base.Protocols.SetHTTP2(true)
+		base.Protocols.SetUnencryptedHTTP2(true)
+	case "3":
+		if !http3Supported {
+			return nil, errors.New("HTTP/3 is not available, build with -tags http3")
+		}
+		transport = &fallbackTransport{primary: newHTTP3Transport(resolver), fallback: base}
+	default:
+		return nil, fmt.Errorf("unknown HTTP version %s, expected auto, 1.1, 2 or 3", c.HTTPVersion)
+	}
+
+	// Without the credentials and headers meant for the crawled sites
+	c.plainTransport = transport
+	if c.Signer != nil {
+		transport = &signingTransport{signer: c.Signer, transport: transport}
+	}
+	// Before signing, the signature may cover the headers
+	if len(c.HeaderProfiles) > 0 {
+		transport = &headerTransport{profiles: c.HeaderProfiles, perHost: c.RotateByHost, transport: transport}
+	}
+	if c.CacheDir != "" {
+		transport = newDiskCache(c.CacheDir, transport)
+	}
+	if len(c.Fetchers) > 0 {
+		transport = &schemeTransport{fetchers: c.Fetchers, next: transport}
+	}
+	if c.RecordDir != "" {
+		transport = &recordTransport{dir: c.RecordDir, transport: transport}
+		c.plainTransport = &recordTransport{dir: c.RecordDir, transport: c.plainTransport}
+	}
+	return &http.Client{Transport: transport, CheckRedirect: c.checkRedirect}, nil
+}
+
+// Try the primary transport first, the fallback when it fails
+// (e.g. a server without HTTP/3). Hosts that failed go straight
+// to the fallback.
+type fallbackTransport struct {
+	primary  http.RoundTripper
+	fallback http.RoundTripper
+
+	mu     sync.Mutex
+	failed map[string]bool
+}
+
+func (t *fallbackTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	failed := t.failed[req.URL.Host]
+	t.mu.Unlock()
+	if req.URL.Scheme == "https" && req.Body == nil && !failed {
+		resp, err := t.primary.RoundTrip(req)
+		if err == nil {
+			return resp, nil
+		}
+		t.mu.Lock()
+		if t.failed == nil {
+			t.failed = make(map[string]bool)
+		}
+		t.failed[req.URL.Host] = true
+		t.mu.Unlock()
+	}
+	return t.fallback.RoundTrip(req)
+}
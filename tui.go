@@ -0,0 +1,205 @@
+//go:build tui
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Log lines and errors kept on screen
+const (
+	tuiLogLines   = 12
+	tuiErrorLines = 5
+)
+
+type tuiTickMsg struct{}
+
+type tuiDoneMsg struct{}
+
+// Dashboard of the running crawl
+type tuiModel struct {
+	c      *Crawler
+	cancel context.CancelFunc
+	log    *logTail
+	errors *logTail
+	status debugStatus
+}
+
+func tuiTick() tea.Cmd {
+	return tea.Tick(500*time.Millisecond, func(time.Time) tea.Msg { return tuiTickMsg{} })
+}
+
+func (m tuiModel) Init() tea.Cmd {
+	return tuiTick()
+}
+
+func (m tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tuiTickMsg:
+		m.status = m.c.debugStatus()
+		return m, tuiTick()
+	case tuiDoneMsg:
+		return m, tea.Quit
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "q", "ctrl+c":
+			m.cancel()
+		case "p":
+			m.c.control.setPaused(!m.c.control.isPaused())
+		case "s":
+			if host := itemHost(queueItem{URL: m.status.URL}); host != "" {
+				m.c.control.skipHost(host)
+			}
+		// The crawler fetches one URL at a time: the pace of the
+		// requests is adjusted through the delay between them
+		case "+":
+			m.c.throttle.setBase(m.c.throttle.baseDelay() + 250*time.Millisecond)
+		case "-":
+			m.c.throttle.setBase(m.c.throttle.baseDelay() - 250*time.Millisecond)
+		}
+	}
+	return m, nil
+}
+
+func (m tuiModel) View() string {
+	var b strings.Builder
+	state := m.status.Stage
+	if m.c.control.isPaused() {
+		state = "paused"
+	}
+	fmt.Fprintf(&b, "Crawling %s\n", m.c.StartURL)
+	fmt.Fprintf(&b, "%-10s %s\n", state, m.status.URL)
+	fmt.Fprintf(&b, "Queued %d  Crawled %d  Delay %s\n", m.status.Queued, m.status.Crawled, m.c.throttle.baseDelay())
+	f := m.status.Frontier
+	if f.Measured {
+		fmt.Fprintf(&b, "Found %.0f/min  Done %.0f/min  ", f.DiscoveryRate, f.CompletionRate)
+	}
+	fmt.Fprintf(&b, "Duplicates %.0f%%  Out of scope %.0f%%  ETA %s\n\n", f.DuplicateRatio*100, f.ScopeRatio*100, f.etaString())
+
+	hosts := make([]string, 0, len(m.status.Hosts))
+	for host := range m.status.Hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Slice(hosts, func(i, j int) bool {
+		return m.status.Hosts[hosts[i]].Pages > m.status.Hosts[hosts[j]].Pages
+	})
+	fmt.Fprintf(&b, "%-40s %8s %8s %10s\n", "HOST", "PAGES", "ERRORS", "AVG")
+	for i, host := range hosts {
+		if i == 10 {
+			fmt.Fprintf(&b, "... %d more hosts\n", len(hosts)-i)
+			break
+		}
+		stats := m.status.Hosts[host]
+		avg := stats.Latency / time.Duration(max(stats.Pages, 1))
+		fmt.Fprintf(&b, "%-40s %8d %8d %10s\n", host, stats.Pages, stats.Errors, avg.Round(time.Millisecond))
+	}
+
+	if errors := m.errors.lines(); len(errors) > 0 {
+		b.WriteString("\nRecent errors:\n")
+		for _, line := range errors {
+			b.WriteString("  " + line + "\n")
+		}
+	}
+
+	b.WriteString("\n")
+	for _, line := range m.log.lines() {
+		b.WriteString(line + "\n")
+	}
+	b.WriteString("\np pause/resume  s skip host  +/- delay between requests  q quit\n")
+	return b.String()
+}
+
+// Last lines written to stdout, or last errors, while the dashboard
+// is shown
+type logTail struct {
+	mu   sync.Mutex
+	size int
+	tail []string
+}
+
+func (l *logTail) add(line string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tail = append(l.tail, line)
+	if len(l.tail) > l.size {
+		l.tail = l.tail[len(l.tail)-l.size:]
+	}
+}
+
+func (l *logTail) lines() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.tail...)
+}
+
+// Run the crawl under the dashboard; its output is shown in the
+// log pane instead of the terminal
+func (c *Crawler) runTUI(ctx context.Context, crawl func(context.Context) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// Created here as the dashboard changes its delay
+	c.throttle = newHostThrottle(c.Delay, c.Jitter, c.AdaptiveDelay)
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	terminal := os.Stdout
+	os.Stdout = w
+	log := &logTail{size: tuiLogLines}
+	copied := make(chan struct{})
+	go func() {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			log.add(scanner.Text())
+		}
+		close(copied)
+	}()
+
+	// Failed requests and error statuses, passed on to the handler set
+	errors := &logTail{size: tuiErrorLines}
+	events := c.events()
+	c.Events = EventFuncs{
+		Fetch: func(e FetchEvent) {
+			if e.Status >= 400 {
+				errors.add(fmt.Sprintf("%d %s", e.Status, e.URL))
+			}
+			events.OnFetch(e)
+		},
+		Save: events.OnSave,
+		Error: func(e ErrorEvent) {
+			errors.add(fmt.Sprintf("%s: %v", e.URL, e.Err))
+			events.OnError(e)
+		},
+		Skip: events.OnSkip,
+	}
+
+	program := tea.NewProgram(tuiModel{c: c, cancel: cancel, log: log, errors: errors}, tea.WithOutput(terminal), tea.WithContext(ctx))
+	result := make(chan error, 1)
+	go func() {
+		err := crawl(ctx)
+		result <- err
+		program.Send(tuiDoneMsg{})
+	}()
+	_, uiErr := program.Run()
+	cancel()
+	err = <-result
+
+	os.Stdout = terminal
+	w.Close()
+	<-copied
+	r.Close()
+	if err == nil && uiErr != nil && ctx.Err() == nil {
+		err = uiErr
+	}
+	return err
+}
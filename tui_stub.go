@@ -0,0 +1,13 @@
+//go:build !tui
+
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+// The dashboard needs bubbletea: build with -tags tui
+func (c *Crawler) runTUI(ctx context.Context, crawl func(context.Context) error) error {
+	return errors.New("the dashboard is not available, build with -tags tui")
+}
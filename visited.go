@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Set of the URLs already crawled
+type Visited interface {
+	Has(url string) bool
+	Add(url string)
+}
+
+func (s State) Has(url string) bool {
+	_, ok := s[url]
+	return ok
+}
+
+func (s State) Add(url string) {
+	if _, ok := s[url]; !ok {
+		s[url] = PageRecord{}
+	}
+}
+
+func hashURL(url string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(url))
+	return h.Sum64()
+}
+
+// Exact set storing only the 64 bit hash of every URL
+type hashSet map[uint64]struct{}
+
+func (s hashSet) Has(url string) bool {
+	_, ok := s[hashURL(url)]
+	return ok
+}
+
+func (s hashSet) Add(url string) {
+	s[hashURL(url)] = struct{}{}
+}
+
+// Bloom filter: it can report a URL never seen as visited,
+// with probability fpRate when it holds the expected number of URLs
+type bloomFilter struct {
+	bits []uint64
+	m    uint64
+	k    uint64
+}
+
+func newBloomFilter(expected int, fpRate float64) *bloomFilter {
+	if expected < 1 {
+		expected = 1
+	}
+	m := uint64(math.Ceil(-float64(expected) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	if m < 64 {
+		m = 64
+	}
+	k := uint64(math.Round(float64(m) / float64(expected) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &bloomFilter{bits: make([]uint64, (m+63)/64), m: m, k: k}
+}
+
+// Double hashing: the i-th position is h1 + i*h2
+func (b *bloomFilter) positions(url string) (uint64, uint64) {
+	h1 := hashURL(url)
+	h := fnv.New64()
+	h.Write([]byte(url))
+	h2 := h.Sum64() | 1
+	return h1, h2
+}
+
+func (b *bloomFilter) Has(url string) bool {
+	h1, h2 := b.positions(url)
+	for i := uint64(0); i < b.k; i++ {
+		pos := (h1 + i*h2) % b.m
+		if b.bits[pos/64]&(1<<(pos%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *bloomFilter) Add(url string) {
+	h1, h2 := b.positions(url)
+	for i := uint64(0); i < b.k; i++ {
+		pos := (h1 + i*h2) % b.m
+		b.bits[pos/64] |= 1 << (pos % 64)
+	}
+}
+
+// Buckets of the hash store, a lookup reads one of them
+const hashStoreBuckets = 4096
+
+// Hashes of the visited URLs on disk, in files by hash. While
+// loading they are kept in memory and written by flush.
+type hashStore struct {
+	dir     string
+	loading [][]byte
+	err     error
+}
+
+// Empty the store, to fill it from the state and the visited log
+func newHashStore(dir string) (*hashStore, error) {
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	return &hashStore{dir: dir, loading: make([][]byte, hashStoreBuckets)}, nil
+}
+
+func (s *hashStore) bucket(h uint64) (int, string) {
+	n := int(h % hashStoreBuckets)
+	return n, filepath.Join(s.dir, fmt.Sprintf("%03x", n))
+}
+
+func (s *hashStore) fail(err error) {
+	if s.err == nil {
+		s.err = fmt.Errorf("visited store %s: %v", s.dir, err)
+	}
+}
+
+func (s *hashStore) Has(url string) bool {
+	h := hashURL(url)
+	n, file := s.bucket(h)
+	var data []byte
+	if s.loading != nil {
+		data = s.loading[n]
+	} else {
+		var err error
+		data, err = os.ReadFile(file)
+		if err != nil && !os.IsNotExist(err) {
+			s.fail(err)
+		}
+	}
+	for i := 0; i+8 <= len(data); i += 8 {
+		if binary.LittleEndian.Uint64(data[i:]) == h {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *hashStore) Add(url string) {
+	h := hashURL(url)
+	n, file := s.bucket(h)
+	if s.loading != nil {
+		s.loading[n] = binary.LittleEndian.AppendUint64(s.loading[n], h)
+		return
+	}
+	out, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		s.fail(err)
+		return
+	}
+	_, err = out.Write(binary.LittleEndian.AppendUint64(nil, h))
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		s.fail(err)
+	}
+}
+
+// Write the hashes added while loading
+func (s *hashStore) flush() error {
+	for n, data := range s.loading {
+		if len(data) == 0 {
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(s.dir, fmt.Sprintf("%03x", n)), data, 0644); err != nil {
+			return fmt.Errorf("visited store %s: %v", s.dir, err)
+		}
+	}
+	s.loading = nil
+	return nil
+}
+
+// Bloom filter confirmed by the hash store: the filter answers for the
+// URLs never seen without reading the disk, a hit is looked up in the
+// store, so a URL is never taken as visited by mistake
+type confirmedBloom struct {
+	filter *bloomFilter
+	store  *hashStore
+}
+
+func (b *confirmedBloom) Has(url string) bool {
+	return b.filter.Has(url) && b.store.Has(url)
+}
+
+func (b *confirmedBloom) Add(url string) {
+	b.filter.Add(url)
+	b.store.Add(url)
+}
+
+func (b *confirmedBloom) Err() error {
+	return b.store.err
+}
+
+// First error of a visited set on disk
+func visitedErr(v Visited) error {
+	if s, ok := v.(interface{ Err() error }); ok {
+		return s.Err()
+	}
+	return nil
+}
+
+// Exact set of URLs
+type urlSet map[string]struct{}
+
+func (s urlSet) Has(url string) bool {
+	_, ok := s[url]
+	return ok
+}
+
+func (s urlSet) Add(url string) {
+	s[url] = struct{}{}
+}
+
+// Set of the URLs queued; with a compact visited set only their 64
+// bit hashes are kept
+func newQueuedSet(mode string) Visited {
+	if mode == "hash" || mode == "bloom" {
+		return hashSet{}
+	}
+	return urlSet{}
+}
+
+// Build the visited set for the given mode ("map", "hash" or "bloom");
+// the bloom filter is backed by a hash store next to the state file
+func newVisited(mode string, state State, stateFile string, expected int, fpRate float64) (Visited, error) {
+	switch mode {
+	case "hash":
+		return hashSet{}, nil
+	case "bloom":
+		store, err := newHashStore(stateFile + ".visited.d")
+		if err != nil {
+			return nil, err
+		}
+		return &confirmedBloom{filter: newBloomFilter(expected, fpRate), store: store}, nil
+	default:
+		return state, nil
+	}
+}
+
+// With a compact visited set the URLs are not kept in memory:
+// they are appended to this file, the exact record used to resume
+func visitedLogFile(stateFile string) string {
+	return stateFile + ".visited"
+}
+
+// Line of the visited log
+type visitedEntry struct {
+	URL string `json:"url"`
+	PageRecord
+}
+
+func appendVisitedLog(file *os.File, url string, rec PageRecord) error {
+	line, err := json.Marshal(visitedEntry{URL: url, PageRecord: rec})
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+// Fill the visited set with the URLs recorded in the log, skipping
+// the ones fetched more than ttl ago
+func loadVisitedLog(logFile string, visited Visited, ttl time.Duration) error {
+	file, err := os.Open(logFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	now := time.Now()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry visitedEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return err
+		}
+		if recordKept(entry.URL, entry.PageRecord, ttl, nil, now) {
+			visited.Add(entry.URL)
+		}
+	}
+	return scanner.Err()
+}
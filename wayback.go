@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+const waybackAPI = "https://archive.org/wayback/available"
+
+// Header marking a response that comes from the Wayback Machine,
+// holding the URL of the snapshot
+const waybackHeader = "X-Crawler-Wayback"
+
+// Answer of the availability API
+type waybackAvailability struct {
+	ArchivedSnapshots struct {
+		Closest struct {
+			Available bool   `json:"available"`
+			URL       string `json:"url"`
+			Timestamp string `json:"timestamp"`
+			Status    string `json:"status"`
+		} `json:"closest"`
+	} `json:"archived_snapshots"`
+}
+
+// Latest snapshot of the page answered by resp, nil if there is
+// none. The snapshot stands for the original response: its request
+// is the original one.
+func (c *Crawler) waybackFallback(ctx context.Context, resp *http.Response) (*http.Response, error) {
+	// Redirects to other hosts are expected here. The signer and the
+	// rotated headers are for the crawled sites only.
+	client := &http.Client{Transport: c.plainTransport}
+	original := resp.Request.URL.String()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, waybackAPI+"?url="+url.QueryEscape(original), nil)
+	if err != nil {
+		return nil, err
+	}
+	apiResp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer apiResp.Body.Close()
+	if apiResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("wayback API answered %s", apiResp.Status)
+	}
+	var available waybackAvailability
+	if err := json.NewDecoder(apiResp.Body).Decode(&available); err != nil {
+		return nil, fmt.Errorf("invalid wayback API answer: %v", err)
+	}
+	closest := available.ArchivedSnapshots.Closest
+	if !closest.Available || closest.Timestamp == "" || closest.Status != "200" {
+		return nil, nil
+	}
+
+	// id_ gets the content as archived, without the Wayback toolbar
+	snapshotURL := fmt.Sprintf("https://web.archive.org/web/%sid_/%s", closest.Timestamp, original)
+	req, err = http.NewRequestWithContext(ctx, resp.Request.Method, snapshotURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	snapshot, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot.StatusCode != http.StatusOK {
+		snapshot.Body.Close()
+		return nil, fmt.Errorf("snapshot %s answered %s", snapshotURL, snapshot.Status)
+	}
+	snapshot.Request = resp.Request
+	snapshot.Header.Set(waybackHeader, closest.URL)
+	return snapshot, nil
+}